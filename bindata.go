@@ -68,7 +68,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _buildConfigYml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x94\x91\x41\xcf\x9a\x40\x10\x86\xef\xfb\x2b\xe6\x07\x08\x68\xd3\x34\xba\x89\x07\x10\x6a\x88\x22\x06\x5b\x2f\x4d\x43\x56\x18\x71\xe3\xb2\x4b\x77\x17\x1b\xff\x7d\x17\xa9\xad\x87\xef\x3b\x7c\xa7\x65\x9e\x77\xde\x77\xc8\x0c\xaf\x29\xf8\xbe\x4f\x2a\x25\x2d\xe3\x12\x35\x25\x00\xf6\xde\x21\x85\x38\x5f\x6d\x92\xc2\x95\xb5\xaa\xae\xa3\x00\xc0\x5b\xd6\xe0\x68\x19\xca\xb3\xd2\x15\xee\x7b\x21\xd2\x91\x9f\x99\x30\xf8\x50\x24\xda\xdf\x4a\x5f\x29\x44\x45\x1a\xaf\x93\x07\xeb\x94\xb6\x19\xeb\x3a\x2e\x1b\x33\xc6\x01\x78\x70\x51\xc6\xee\x9d\x42\x61\x3a\x76\x31\xcd\x5a\xb4\xa8\xff\xf7\xfc\x7d\x01\xae\x78\xa7\x20\x54\xe3\xd5\x9a\xdf\x50\xff\xe3\x37\x26\x7a\x37\xbe\x41\x71\x7e\xdf\xa3\x3a\xfb\x96\xc1\x63\x75\xad\xd1\x98\x65\x5f\x77\x34\x08\x4e\xec\x24\x3c\xc3\x2c\x0a\xc1\x2d\xce\xe8\xe7\xc5\x7c\xfe\xa1\x4c\x94\xb7\x65\x14\x46\xdb\x32\xcb\xe3\xef\xdb\x64\xf2\xf2\x5d\x1e\x93\xe2\x90\xe6\xbb\xc9\x21\x29\x8e\xe9\x2a\x29\xbf\x85\xeb\x03\xe1\xd2\x58\x26\x2b\x34\x14\x66\xa4\xea\x7a\xf7\x4e\xfd\x19\x69\xb1\x75\xe0\x0b\xe9\x35\x77\xe4\xc7\x4f\xe2\x82\x87\x8d\xbc\x7a\x29\x0c\xbf\xeb\xe0\xcb\x90\xe7\x75\x1e\x68\x95\x67\x59\xb8\x8b\x29\x04\x27\x2e\x03\xb7\xfb\xa7\xb0\x09\xbf\x6e\xc2\x32\x2a\x72\x77\x63\x17\xf3\xab\xc7\x1e\xfd\x21\xcc\x37\x17\xba\x98\x2e\x3e\x91\xaa\xad\xc7\x78\xcf\xa0\x1e\x96\xfd\x27\x00\x00\xff\xff\x9a\xe6\x30\xb5\x2c\x02\x00\x00")
+var _buildConfigYml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x92\xcd\x6e\xdb\x30\x10\x84\xef\x7c\x8a\x7d\x80\xf8\x47\x4d\x1b\x24\x04\x72\xf0\x8f\x92\x1a\x8e\x63\x43\x4e\x73\x09\x02\x63\x4d\xae\x65\xc2\x14\xc9\xf2\x47\xb5\x51\xf4\xdd\x0b\x59\xb5\xe3\x43\x7b\xe8\x49\xd4\x37\xe4\x6a\x34\x1c\x25\x39\x74\xbb\x5d\xe6\xa9\x54\x21\xfa\x03\x87\xd3\xaa\xbb\xc6\xb5\xee\x86\x2d\x13\xd6\x44\x54\x86\x3c\x67\x00\xf1\xe0\x88\xc3\x78\x3e\x9a\xe6\x05\x03\x90\x56\xec\x5a\x01\x40\x55\x58\x52\x3b\xad\x79\xdd\x58\x2f\x68\x91\xb4\x9e\xb4\x7c\x83\x3a\xd0\x51\x31\x14\x7f\x58\xbf\xe3\x30\x2c\x26\xe3\xc7\xfc\xc8\x9c\xf5\x71\x86\xce\x29\x53\x86\x76\x1c\x40\x07\xb6\x36\xc4\x85\xf5\x91\x43\xff\xc8\x1c\x7a\xac\x28\x92\xff\xd8\xf3\xe7\x09\xb0\xa3\x03\x07\x6d\xcb\x8e\xf4\xaa\x26\x7f\xe6\x35\xea\x44\x1c\x4a\xd2\x9b\x7f\x9f\xb1\x2e\xfe\xed\x40\x07\xa5\xf4\x14\xc2\x7d\x92\x8e\xf7\x7a\x4d\x22\x9d\x80\x91\xb4\x56\x91\x32\xfe\xf9\xee\xf6\xf6\xbf\x66\x92\xa9\xef\x87\x83\xe1\xd3\x6a\x36\x1f\x7f\x7b\xca\xaf\x2e\xd6\xab\xd7\xbc\x58\x4e\xe6\xcf\x57\xcb\xbc\x78\x9d\x8c\xf2\xd5\xcb\xe0\x71\xc9\x94\x09\x11\x8d\xa0\xc0\x21\x63\xc2\xa5\xc0\xa1\xdf\xcd\x58\x45\x15\x87\xec\x86\x49\x15\x76\x4d\x36\xc9\xab\xc0\xe1\xed\x9d\x91\xa9\x9b\x64\x2e\x67\x70\x68\x6c\x33\x80\x8b\x8f\x9d\x6e\xe9\x88\x46\xf3\xd9\x6c\xf0\x3c\xe6\xd0\x5b\x2b\xd3\x43\xe7\x4e\xc2\x74\xf0\x30\x1d\xac\x86\xc5\x7c\x9a\x17\x4b\x0e\xdf\x13\x25\x3a\xb5\x82\xdf\xf5\xef\x3e\x31\x51\xc9\x76\x7c\x27\x90\x6f\x42\x4f\xae\xf4\x28\x69\x19\x3d\x46\x2a\x0f\x8d\x97\x4a\x19\x55\xa5\xea\x2b\xa1\x8e\xdb\x11\x3a\x14\x2a\x1e\x9a\xdf\x01\xa8\x70\xdf\x48\xf3\x9a\xfc\xa5\xb0\x46\xb1\xb3\x9b\xcd\x92\x84\x35\x32\x5c\x90\x07\x14\xd1\x7a\x0e\x59\x37\xfb\xc2\x2a\xdc\x3f\x61\x32\x62\x3b\x26\x8d\x87\xf3\xe6\xeb\x9b\x7e\xbf\xa9\x6c\x88\x1e\x95\x89\x6d\x2c\x1a\xd7\xa4\x03\x87\x9f\xbf\x18\x0a\x41\x2e\x92\x2c\x28\xd8\xe4\x05\x15\x56\x37\xe9\xbe\xbd\xb3\x6d\xeb\x70\x4b\x62\x77\xac\x57\x7b\xa5\xce\xdb\x68\x85\xd5\x1c\x5e\x46\x8b\x73\x55\x27\x46\xd2\xfe\xd4\xca\xd2\xa3\xa0\x05\x79\x65\xe5\xd9\xc6\x4d\x2b\x29\x13\xc9\xd7\xa8\x3f\xec\xb5\x3c\xaa\x8a\x6c\x8a\x67\x9c\xb5\xb8\xc2\xfd\xc8\x9a\x40\x22\x45\x55\xd3\x03\x2a\x9d\x3c\x05\x0e\xd7\xec\xf7\x00\x5d\x7b\x29\xad\xa8\x03\x00\x00")
 
 func buildConfigYmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -83,7 +83,7 @@ func buildConfigYml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "build-config.yml", size: 556, mode: os.FileMode(420), modTime: time.Unix(1467304033, 0)}
+	info := bindataFileInfo{name: "build-config.yml", size: 936, mode: os.FileMode(420), modTime: time.Unix(1792300797, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
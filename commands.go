@@ -3,96 +3,103 @@ package main
 //go:generate go-bindata -nocompress build-config.yml
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
-	"time"
 
-	"github.com/imdario/mergo"
-	"gopkg.in/yaml.v2"
+	"github.com/babl/babl-build/marathon"
 )
 
-const retries = 3
-
 var stdout io.Writer = os.Stdout // allow reassignment
 var _conf *config = nil          // cache conf()'s result
 
 // auxiliary functions
 
+// conf returns the config of the module, loaded on first use.
 func conf() config {
 	if _conf != nil {
 		return *_conf
 	}
-
-	var c config
-	contents, err := Asset("build-config.yml")
+	c, origins, err := loadConfig(moduleDirectory(), manifestPath())
 	if err != nil {
-		panic(err)
-	}
-	if err := yaml.Unmarshal(contents, &c); err != nil {
-		panic(err)
-	}
-	if contents, err = ioutil.ReadFile("babl.yml"); err != nil {
 		log.Fatal(err)
 	}
+	_conf, _origins = &c, origins
+	return c
+}
+
+func containerOptions() []string {
+	if opts := conf().Container.Options; opts != nil {
+		return opts
+	}
+	return []string{}
+}
 
-	var local config
-	if err := yaml.Unmarshal(contents, &local); err != nil {
+// dockerEnv returns docker run arguments for all env variables of the
+// merged config, including the ones babl-build sets up itself, and all
+// secrets, along with the environment to run docker in. Secrets are passed
+// by name, their values only in that environment, so they show up neither
+// in the printed command line nor in ps. Outside production the default
+// Kafka brokers are left out, so local runs only use the production queue
+// if babl.yml asks for it.
+func dockerEnv(production bool) ([]string, []string) {
+	secrets, err := localSecrets(conf(), !dryRun)
+	if err != nil {
 		log.Fatal(err)
 	}
-	if err := mergo.MergeWithOverwrite(&c, local); err != nil {
-		panic(err)
+	env := envVars{}
+	for name, value := range conf().Env {
+		if production || name != "BABL_KAFKA_BROKERS" || _origins["env."+name].Source != "default" {
+			env[name] = value
+		}
 	}
-
-	// Ugly hack to support unlimited memory usage / zero value
-	if local.Mem != nil && *local.Mem == 0 {
-		*c.Mem = 0
+	names := []string{}
+	for name := range env {
+		names = append(names, name)
 	}
-
-	if c.Env.ServiceTags == "web" {
-		reg := regexp.MustCompile(":4[0-9]+$")
-		for i := 0; i < len(c.Container.Docker.Parameters); i++ {
-			param := &c.Container.Docker.Parameters[i]
-			if param.Key == "log-opt" {
-				param.Value = reg.ReplaceAllString(param.Value, ":4990")
-			}
+	for name := range secrets {
+		if _, ok := env[name]; !ok {
+			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
 
-	if c.Container.Docker.Network == "HOST" {
-		c.Container.Docker.PortMappings = nil
+	args, values := []string{}, []string{}
+	for _, name := range names {
+		if value, ok := env[name]; ok {
+			args = append(args, "-e", name+"="+value)
+		} else {
+			args = append(args, "-e", name)
+			values = append(values, name+"="+secrets[name])
+		}
 	}
-
-	_conf = &c
-	c.Container.Docker.Image = image()
-	c.Env.BablModule = module()
-	c.Env.BablModuleVersion = version()
-	return c
+	return args, values
 }
 
-func containerOptions() []string {
-	if opts := overwrites.Container.Options; opts != nil {
-		return opts
-	}
-	return []string{}
+func execute(name string, args ...string) {
+	executeWithEnv(nil, name, args...)
 }
 
-func execute(name string, args ...string) {
+// executeWithEnv runs a command with env added to its environment, which
+// is not printed.
+func executeWithEnv(env []string, name string, args ...string) {
 	msg := name + " " + strings.Join(args, " ")
 	if dryRun {
 		fmt.Println(msg)
 	} else {
 		fmt.Fprintln(os.Stderr, msg)
 		cmd := exec.Command(name, args...)
+		cmd.Env = append(os.Environ(), env...)
 		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
 		if err := cmd.Run(); err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
@@ -116,38 +123,36 @@ func id() string {
 	return conf().Id
 }
 
+// parseInstances parses the number of instances given to scale.
+func parseInstances(arg string) (int, error) {
+	instances, err := strconv.Atoi(arg)
+	if err != nil || instances < 0 {
+		return 0, fmt.Errorf("Invalid number of instances %q", arg)
+	}
+	return instances, nil
+}
+
 func image() string {
-	return fmt.Sprintf("registry.babl.sh/%s:%s", id(), version())
+	return fmt.Sprintf("%s/%s:%s", conf().Registry, id(), version())
 }
 
 func imageLatest() string {
 	return regexp.MustCompile(":[^:]+$").ReplaceAllString(image(), ":latest")
 }
 
-func module() string {
-	return id()
-}
-
 func _type() string {
-	if tags := overwrites.Env.ServiceTags; tags != "" {
+	if tags := conf().Env["SERVICE_TAGS"]; tags != "" {
 		return tags
 	}
 	return "babl"
 }
 
 func version() string {
-	output, err := exec.Command("git", "rev-list", "HEAD", "--count").Output()
-	if err == nil {
-		return "v" + strings.TrimSpace(string(output))
-	} else {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.Sys().(syscall.WaitStatus).ExitStatus() == 128 {
-				return "v0"
-			}
-		}
+	v, err := gitVersion(moduleDirectory())
+	if err != nil {
+		log.Fatal(err)
 	}
-	log.Fatal(err)
-	return "fail"
+	return v
 }
 
 // commands proper
@@ -164,8 +169,9 @@ func init() {
 		"build": {
 			"Build Docker image",
 			func(args ...string) {
+				mustValidate()
 				cmd := append([]string{"build", "-t", image()}, args...)
-				cmd = append(cmd, ".")
+				cmd = append(cmd, moduleDirectory())
 				execute("docker", cmd...)
 
 				cmd = []string{"tag"}
@@ -185,30 +191,71 @@ func init() {
 		"versions": {
 			"Print module and babl-server version",
 			func(args ...string) {
+				mustValidate()
 				fmt.Println("module: " + version())
 
 				execArgs := []string{"docker", "run", "--rm", image(), "babl-server", "-version"}
 				execute(execArgs[0], execArgs[1:]...)
 			},
 		},
+		"events": {
+			"Stream Marathon events concerning this module",
+			func(args ...string) {
+				mustValidate()
+				err := marathonClient().Events(context.Background(), func(e marathon.Event) bool {
+					if e.Affects(id()) {
+						fmt.Fprintf(stdout, "%s %s\n", e.Timestamp, formatEvent(e))
+					}
+					return true
+				})
+				if err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
 		"image": {
 			"Print docker image",
 			func(args ...string) {
+				mustValidate()
 				fmt.Println(image())
 			},
 		},
 		"config": {
 			"Print the Marathon JSON config",
 			func(args ...string) {
-				err := json.NewEncoder(stdout).Encode(conf())
+				mustValidate()
+				def, err := marathonDefinition(conf())
 				if err != nil {
+					log.Fatal(err)
+				}
+				if explainConfig || (len(args) > 0 && args[0] == "--explain") {
+					explain(def)
+					return
+				}
+				if err := json.NewEncoder(stdout).Encode(def); err != nil {
 					panic(err)
 				}
 			},
 		},
+		"validate": {
+			"Check babl.yml for unknown keys and invalid values",
+			func(args ...string) {
+				mustValidate()
+				fmt.Fprintln(stdout, manifestPath()+" is valid")
+			},
+		},
+		"schema": {
+			"Print a JSON Schema of babl.yml",
+			func(args ...string) {
+				out, err := json.MarshalIndent(schema(), "", "  ")
+				check(err)
+				fmt.Fprintln(stdout, string(out))
+			},
+		},
 		"push": {
 			"Push Docker image to remote registry",
 			func(args ...string) {
+				mustValidate()
 				execute("docker", "push", image())
 				execute("docker", "push", imageLatest())
 			},
@@ -216,106 +263,219 @@ func init() {
 		"deploy": {
 			"Deploy a Babl module",
 			func(args ...string) {
-				for i := 0; i < retries; i++ {
-					body := bytes.NewBuffer([]byte{})
-					err := json.NewEncoder(body).Encode(conf())
-					if err != nil {
-						panic(err)
-					}
-					req, err := http.NewRequest("POST",
-						fmt.Sprintf("http://%s:8080/v2/apps", marathonHost),
-						body)
-					if err != nil {
-						log.Fatal(err)
-					}
-					req.Header.Set("Content-Type", "application/json")
+				mustValidate()
+				if err := deployableSecrets(conf()); err != nil {
+					log.Fatal(err)
+				}
+				// Sent with --dry-run too, like all GET requests, to tell
+				// whether a deploy would PUT or POST the app
+				exists, err := appExists(id())
+				if err != nil {
+					log.Fatal(err)
+				}
 
-					resp, err := (&http.Client{}).Do(req)
-					if err != nil {
-						log.Fatal(err)
-					}
+				def, err := marathonDefinition(conf())
+				if err != nil {
+					log.Fatal(err)
+				}
 
-					_, _ = io.Copy(stdout, resp.Body) // ignore error
-					_ = resp.Body.Close()             // ignore error
-					if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-						log.Printf("HTTP POST request returned %s",
-							resp.Status)
+				ctx := context.Background()
+				awaitDeployment(func() (marathon.DeploymentRef, error) {
+					if exists {
+						return marathonClient().UpdateApp(ctx, id(), def, force)
 					}
-					if resp.StatusCode == http.StatusConflict && i < retries {
-						log.Print("Retrying in 1 second...")
-						time.Sleep(time.Second)
-						continue
+					app, err := marathonClient().CreateApp(ctx, def)
+					if err != nil || len(app.Deployments) == 0 {
+						return marathon.DeploymentRef{}, err
 					}
-					break
+					return app.Deployments[0], nil
+				})
+			},
+		},
+		"diff": {
+			"Compare the local config to the deployed one",
+			func(args ...string) {
+				mustValidate()
+				diffs, err := deployedDiff(id())
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, d := range diffs {
+					fmt.Fprintf(stdout, "%s: %s -> %s\n", d.Path, d.Remote, d.Local)
+				}
+				if len(diffs) > 0 {
+					os.Exit(1)
 				}
 			},
 		},
 		"destroy": {
 			"Destroy a Babl module",
 			func(args ...string) {
-				req, err := http.NewRequest("DELETE",
-					fmt.Sprintf("http://%s:8080/v2/apps/%s",
-						marathonHost, id()), nil)
+				mustValidate()
+				awaitDeployment(func() (marathon.DeploymentRef, error) {
+					return marathonClient().DeleteApp(context.Background(), id(), force)
+				})
+			},
+		},
+		"restart": {
+			"restart all instances of this module",
+			func(args ...string) {
+				mustValidate()
+				if hard {
+					// Marathon rejects the deploy while the app is still
+					// being deleted, so wait regardless of --no-wait
+					ref, err := marathonClient().DeleteApp(context.Background(), id(), force)
+					if err != nil {
+						log.Fatal(err)
+					}
+					if !dryRun {
+						if err := waitForDeployment(ref, nil); err != nil {
+							log.Fatal(err)
+						}
+					}
+					commands["deploy"].Func()
+					return
+				}
+				awaitDeployment(func() (marathon.DeploymentRef, error) {
+					return marathonClient().RestartApp(context.Background(), id(), force)
+				})
+			},
+		},
+		"rollback": {
+			"Redeploy a previous version (default: the one before the current)",
+			func(args ...string) {
+				mustValidate()
+				wanted := ""
+				if len(args) > 0 {
+					wanted = args[0]
+				}
+				version, target, err := rollbackTarget(id(), wanted)
 				if err != nil {
 					log.Fatal(err)
 				}
-				resp, err := (&http.Client{}).Do(req)
+
+				fmt.Fprintf(os.Stderr, "Rolling back %s to %s (%s)\n", id(), version, target)
+				body := map[string]string{"version": target}
+				awaitDeployment(func() (marathon.DeploymentRef, error) {
+					return marathonClient().UpdateApp(context.Background(), id(), body, force)
+				})
+			},
+		},
+		"scale": {
+			"Change the number of running instances",
+			func(args ...string) {
+				mustValidate()
+				if len(args) != 1 {
+					log.Fatal("Usage: scale N")
+				}
+				instances, err := parseInstances(args[0])
 				if err != nil {
 					log.Fatal(err)
 				}
-				_, _ = io.Copy(stdout, resp.Body) // ignore error
-				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-					log.Fatalf("HTTP DELETE request returned %s", resp.Status)
+				if declared := conf().Instances; declared != instances {
+					log.Printf("Warning: babl.yml declares %d instances, the next deploy will scale back to it",
+						declared)
 				}
+				awaitDeployment(func() (marathon.DeploymentRef, error) {
+					return marathonClient().ScaleApp(context.Background(), id(), instances, force)
+				})
 			},
 		},
-		"restart": {
-			"restart all instances of this module",
+		"secret": {
+			"Encrypt a secret read from stdin into the secrets file",
 			func(args ...string) {
-				commands["destroy"].Func()
-				commands["deploy"].Func()
+				if len(args) != 1 {
+					log.Fatal("Usage: secret NAME < value")
+				}
+				value, err := ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					log.Fatal(err)
+				}
+				err = writeSecret(args[0], strings.TrimRight(string(value), "\r\n"))
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Fprintf(os.Stderr, "Secret %s written to %s, use it with secrets.NAME.encrypted: %s\n",
+					args[0], secretsPath(), args[0])
+			},
+		},
+		"status": {
+			"Print the live state of this module in Marathon",
+			func(args ...string) {
+				mustValidate()
+				status, err := fetchStatus(id())
+				if err != nil {
+					log.Fatal(err)
+				}
+				if jsonOutput {
+					if err := json.NewEncoder(stdout).Encode(status); err != nil {
+						panic(err)
+					}
+					return
+				}
+
+				fmt.Fprintf(stdout, "id:        %s\n", status.Id)
+				fmt.Fprintf(stdout, "image:     %s\n", status.Image)
+				fmt.Fprintf(stdout, "version:   %s deployed, %s local\n",
+					status.DeployedVersion, status.LocalVersion)
+				if status.Profile != "" {
+					fmt.Fprintf(stdout, "profile:   %s\n", status.Profile)
+				}
+				fmt.Fprintf(stdout, "instances: %d (%d running, %d staged, %d healthy, %d unhealthy)\n",
+					status.Instances, status.Running, status.Staged,
+					status.Healthy, status.Unhealthy)
+				for _, task := range status.Tasks {
+					ports := make([]string, len(task.Ports))
+					for i, port := range task.Ports {
+						ports[i] = fmt.Sprint(port)
+					}
+					fmt.Fprintf(stdout, "  %s %s:%s %s\n", task.Id, task.Host,
+						strings.Join(ports, ","), task.State)
+				}
+				for _, d := range status.Deployments {
+					fmt.Fprintf(stdout, "deployment %s: step %d/%d\n",
+						d.Id, d.CurrentStep, d.TotalSteps)
+				}
 			},
 		},
 		"play": {
 			"Play (run) a local built Babl module",
 			func(args ...string) {
+				mustValidate()
 				execArgs := []string{"docker", "run", "-it", "--rm", "-p", "4444:4444",
 					"-e", "PORT=4444",
-					"-e", "BABL_MODULE=" + module(),
-					"-e", "BABL_MODULE_VERSION=" + version(),
-					"-e", "BABL_COMMAND=/bin/app",
 				}
+				envArgs, env := dockerEnv(false)
+				execArgs = append(execArgs, envArgs...)
 				execArgs = append(execArgs, containerOptions()...)
 				execArgs = append(execArgs, image())
-				execute(execArgs[0], execArgs[1:]...)
+				executeWithEnv(env, execArgs[0], execArgs[1:]...)
 			},
 		},
 		"sh": {
 			"Run the container with a shell",
 			func(args ...string) {
-				execArgs := []string{"docker", "run", "-it", "--rm", "-p", "4444:4444",
-					"-e", "BABL_MODULE=" + module(),
-					"-e", "BABL_MODULE_VERSION=" + version(),
-					"-e", "BABL_COMMAND=/bin/app",
-				}
+				mustValidate()
+				execArgs := []string{"docker", "run", "-it", "--rm", "-p", "4444:4444"}
+				envArgs, env := dockerEnv(false)
+				execArgs = append(execArgs, envArgs...)
 				execArgs = append(execArgs, containerOptions()...)
 				execArgs = append(execArgs, image(), "sh")
-				execute(execArgs[0], execArgs[1:]...)
+				executeWithEnv(env, execArgs[0], execArgs[1:]...)
 			},
 		},
 		"run-in-production": {
 			"Run one instance of this module in production",
 			func(args ...string) {
+				mustValidate()
 				execArgs := []string{"docker", "run", "-it", "--rm", "-p", "4444",
 					"-e", "PORT=4444",
-					"-e", "BABL_MODULE=" + module(),
-					"-e", "BABL_MODULE_VERSION=" + version(),
-					"-e", "BABL_COMMAND=/bin/app",
-					"-e", "BABL_KAFKA_BROKERS=queue.babl.sh:9092",
 				}
+				envArgs, env := dockerEnv(true)
+				execArgs = append(execArgs, envArgs...)
 				execArgs = append(execArgs, containerOptions()...)
 				execArgs = append(execArgs, image())
-				execute(execArgs[0], execArgs[1:]...)
+				executeWithEnv(env, execArgs[0], execArgs[1:]...)
 			},
 		},
 		"help": {
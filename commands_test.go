@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRestart(t *testing.T) {
+	setupFor("string-upcase")
+	server := newFakeMarathon(map[string][]string{
+		"POST /v2/apps/larskluge/string-upcase/restart": {`{"deploymentId": "d1", "version": "2026-10-18T10:00:00.000Z"}`},
+		"GET /v2/deployments":                           {`[{"id": "d1", "currentStep": 1, "totalSteps": 1}]`, `[]`},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		commands["restart"].Func()
+	})
+	want := []string{"POST /v2/apps/larskluge/string-upcase/restart"}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+}
+
+func TestHardRestartWaitsForDestroy(t *testing.T) {
+	setupFor("string-upcase")
+	hard, noWait = true, true
+	defer func() { hard, noWait = false, false }()
+	server := newFakeMarathon(map[string][]string{
+		"DELETE /v2/apps/larskluge/string-upcase": {`{"deploymentId": "d1", "version": "2026-10-18T10:00:00.000Z"}`},
+		"GET /v2/deployments":                     {`[{"id": "d1", "currentStep": 1, "totalSteps": 1}]`, `[]`},
+		"POST /v2/apps":                           {`{"id": "/larskluge/string-upcase", "deployments": [{"id": "d2"}]}`},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		commands["restart"].Func()
+	})
+	want := []string{
+		"DELETE /v2/apps/larskluge/string-upcase",
+		"GET /v2/apps/larskluge/string-upcase",
+		"POST /v2/apps",
+	}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	polls := 0
+	for _, r := range server.requests {
+		if r == "POST /v2/apps" && polls < 2 {
+			t.Errorf("deploy sent before the app was destroyed: %v", server.requests)
+		}
+		if r == "GET /v2/deployments" {
+			polls++
+		}
+	}
+}
+
+func rollbackMarathon() *fakeMarathon {
+	return newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase/versions": {`{"versions": [
+			"2026-10-18T10:00:00.000Z", "2026-10-17T10:00:00.000Z",
+			"2026-10-16T10:00:00.000Z", "2026-10-15T10:00:00.000Z"]}`},
+		"GET /v2/apps/larskluge/string-upcase/versions/2026-10-18T10:00:00.000Z": {`{"env": {"BABL_MODULE_VERSION": "v21"}}`},
+		"GET /v2/apps/larskluge/string-upcase/versions/2026-10-17T10:00:00.000Z": {`{"env": {"BABL_MODULE_VERSION": "v21"}}`},
+		"GET /v2/apps/larskluge/string-upcase/versions/2026-10-16T10:00:00.000Z": {`{"env": {"BABL_MODULE_VERSION": "v20"}}`},
+		"GET /v2/apps/larskluge/string-upcase/versions/2026-10-15T10:00:00.000Z": {`{"env": {"BABL_MODULE_VERSION": "v19"}}`},
+		"PUT /v2/apps/larskluge/string-upcase":                                   {`{"deploymentId": "d1", "version": "2026-10-18T11:00:00.000Z"}`},
+		"GET /v2/deployments":                                                    {`[]`},
+	})
+}
+
+func TestRollbackToPreviousVersion(t *testing.T) {
+	setupFor("string-upcase")
+	server := rollbackMarathon()
+	defer server.Close()
+
+	var output string
+	withMarathon(server.URL, func() {
+		output = captureStderr(func() { commands["rollback"].Func() })
+	})
+	if !strings.Contains(output, "Rolling back larskluge/string-upcase to v20 (2026-10-16T10:00:00.000Z)") {
+		t.Errorf("output mismatch: got %q", output)
+	}
+	if body := server.body("PUT /v2/apps/larskluge/string-upcase"); body != `{"version":"2026-10-16T10:00:00.000Z"}` {
+		t.Errorf("body mismatch: got %s", body)
+	}
+}
+
+func TestRollbackToGivenVersion(t *testing.T) {
+	setupFor("string-upcase")
+	server := rollbackMarathon()
+	defer server.Close()
+
+	var output string
+	withMarathon(server.URL, func() {
+		output = captureStderr(func() { commands["rollback"].Func("v19") })
+	})
+	if !strings.Contains(output, "Rolling back larskluge/string-upcase to v19 (2026-10-15T10:00:00.000Z)") {
+		t.Errorf("output mismatch: got %q", output)
+	}
+	if body := server.body("PUT /v2/apps/larskluge/string-upcase"); body != `{"version":"2026-10-15T10:00:00.000Z"}` {
+		t.Errorf("body mismatch: got %s", body)
+	}
+}
+
+func TestRollbackVersionNotFound(t *testing.T) {
+	setupFor("string-upcase")
+	server := rollbackMarathon()
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		_, _, err := rollbackTarget("larskluge/string-upcase", "v7")
+		if err == nil || err.Error() != "Version v7 of larskluge/string-upcase not found" {
+			t.Errorf("error mismatch: got %v", err)
+		}
+		_, _, err = rollbackTarget("larskluge/string-upcase", "v21")
+		if err == nil || err.Error() != "Version v21 of larskluge/string-upcase is already deployed" {
+			t.Errorf("error mismatch: got %v", err)
+		}
+	})
+	for _, r := range server.received() {
+		if strings.HasPrefix(r, "PUT ") {
+			t.Errorf("rolled back to a missing version: %v", server.received())
+		}
+	}
+}
+
+func TestDeployUpdatesExistingApp(t *testing.T) {
+	setupFor("string-upcase")
+	server := newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase": {`{"app": {"id": "/larskluge/string-upcase"}}`},
+		"PUT /v2/apps/larskluge/string-upcase": {`{"deploymentId": "d1", "version": "2026-10-18T10:00:00.000Z"}`},
+		"GET /v2/deployments":                  {`[]`},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		commands["deploy"].Func()
+	})
+	want := []string{
+		"GET /v2/apps/larskluge/string-upcase",
+		"PUT /v2/apps/larskluge/string-upcase",
+	}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+	if body := server.body("PUT /v2/apps/larskluge/string-upcase"); !strings.Contains(body, `"id":"larskluge/string-upcase"`) {
+		t.Errorf("body mismatch: want app definition; got %s", body)
+	}
+}
+
+func TestDeployCreatesMissingApp(t *testing.T) {
+	setupFor("string-upcase")
+	server := newFakeMarathon(map[string][]string{
+		"POST /v2/apps":       {`{"id": "/larskluge/string-upcase", "deployments": [{"id": "d1"}]}`},
+		"GET /v2/deployments": {`[]`},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		commands["deploy"].Func()
+	})
+	want := []string{
+		"GET /v2/apps/larskluge/string-upcase",
+		"POST /v2/apps",
+	}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+}
+
+func TestDeployForce(t *testing.T) {
+	setupFor("string-upcase")
+	force = true
+	defer func() { force = false }()
+	server := newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase": {`{"app": {"id": "/larskluge/string-upcase"}}`},
+		"PUT /v2/apps/larskluge/string-upcase": {`{"deploymentId": "d1", "version": "2026-10-18T10:00:00.000Z"}`},
+		"GET /v2/deployments":                  {`[]`},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		commands["deploy"].Func()
+	})
+	want := []string{
+		"GET /v2/apps/larskluge/string-upcase",
+		"PUT /v2/apps/larskluge/string-upcase?force=true",
+	}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	setupFor("string-upcase")
+	server := newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase": {`{"app": {
+			"id": "/larskluge/string-upcase", "instances": 3,
+			"tasksRunning": 2, "tasksStaged": 1, "tasksHealthy": 2, "tasksUnhealthy": 0,
+			"container": {"docker": {"image": "registry.babl.sh/larskluge/string-upcase:v19"}},
+			"labels": {"BABL_PROFILE": "production"},
+			"tasks": [
+				{"id": "t1", "host": "agent1", "ports": [31001], "state": "TASK_RUNNING"},
+				{"id": "t2", "host": "agent2", "ports": [31002], "state": "TASK_RUNNING"},
+				{"id": "t3", "host": "agent3", "ports": [31003], "state": "TASK_STAGING"}
+			],
+			"deployments": [{"id": "d1"}]
+		}}`},
+		"GET /v2/deployments": {`[{"id": "d1", "currentStep": 1, "totalSteps": 2}]`},
+	})
+	defer server.Close()
+
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	withMarathon(server.URL, func() {
+		commands["status"].Func()
+	})
+	output := buf.String()
+	for _, expected := range []string{
+		"version:   v19 deployed, " + version() + " local\n",
+		"profile:   production\n",
+		"instances: 3 (2 running, 1 staged, 2 healthy, 0 unhealthy)\n",
+		"  t3 agent3:31003 TASK_STAGING\n",
+		"deployment d1: step 1/2\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output mismatch: want %q; got %q", expected, output)
+		}
+	}
+	if requests := server.received(); len(requests) != 1 ||
+		requests[0] != "GET /v2/apps/larskluge/string-upcase?embed=apps.tasks" {
+		t.Errorf("requests mismatch: got %v", requests)
+	}
+}
+
+func TestScale(t *testing.T) {
+	setupFor("string-upcase")
+	server := newFakeMarathon(map[string][]string{
+		"PATCH /v2/apps/larskluge/string-upcase": {`{"deploymentId": "d1", "version": "2026-10-18T10:00:00.000Z"}`},
+		"GET /v2/deployments":                    {`[]`},
+	})
+	defer server.Close()
+
+	var output string
+	withMarathon(server.URL, func() {
+		output = captureStderr(func() { commands["scale"].Func("3") })
+	})
+	if body := server.body("PATCH /v2/apps/larskluge/string-upcase"); body != `{"instances":3}` {
+		t.Errorf("body mismatch: got %s", body)
+	}
+	expected := "babl.yml declares 1 instances, the next deploy will scale back to it"
+	if !strings.Contains(output, expected) {
+		t.Errorf("output mismatch: want %q; got %q", expected, output)
+	}
+}
+
+func TestScaleInvalidInstances(t *testing.T) {
+	for _, arg := range []string{"-1", "two", "1.5", ""} {
+		if _, err := parseInstances(arg); err == nil {
+			t.Errorf("want error for %q", arg)
+		}
+	}
+	if instances, err := parseInstances("0"); err != nil || instances != 0 {
+		t.Errorf("instances mismatch: want 0; got %d, %v", instances, err)
+	}
+}
+
+func TestDeployDryRun(t *testing.T) {
+	setupFor("string-upcase")
+	marathonToken, dryRun = "s3cr3t", true
+	defer func() { marathonToken, dryRun = "", false }()
+	server := newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase": {`{"app": {"id": "/larskluge/string-upcase"}}`},
+	})
+	defer server.Close()
+
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	withMarathon(server.URL, func() {
+		commands["deploy"].Func()
+	})
+	want := []string{"GET /v2/apps/larskluge/string-upcase"}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests mismatch: want %v; got %v", want, got)
+	}
+	expected := "PUT " + server.URL + "/v2/apps/larskluge/string-upcase\n" +
+		"Authorization: Bearer xxxxx\n" +
+		"Content-Type: application/json\n"
+	if output := buf.String(); !strings.HasPrefix(output, expected) {
+		t.Errorf("output mismatch: want %q; got %q", expected, output)
+	}
+}
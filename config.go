@@ -1,13 +1,19 @@
 package main
 
 import (
-	"io/ioutil"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"github.com/imdario/mergo"
 )
 
 type config struct {
 	Id        string `yaml:"id" json:"id"`
+	Registry  string `yaml:"registry" json:"-"`
 	Container struct {
 		Type   string `yaml:"type" json:"type"`
 		Docker struct {
@@ -15,6 +21,7 @@ type config struct {
 			ForcePullImage bool   `yaml:"forcePullImage" json:"forcePullImage,omitempty"`
 			Network        string `yaml:"network" json:"network"`
 			PortMappings   []struct {
+				Name          string `yaml:"name" json:"name,omitempty"`
 				ContainerPort int    `yaml:"containerPort" json:"containerPort,omitempty"`
 				HostPort      int    `yaml:"hostPort" json:"hostPort"`
 				ServicePort   int    `yaml:"servicePort" json:"servicePort,omitempty"`
@@ -32,25 +39,171 @@ type config struct {
 			Mode          string `yaml:"mode" json:"mode"`
 		} `yaml:"volumes" json:"volumes,omitempty"`
 	} `yaml:"container" json:"container"`
-	Instances int      `yaml:"instances" json:"instances"`
-	Cpus      float64  `yaml:"cpus" json:"cpus"`
-	Mem       *float64 `yaml:"mem" json:"mem"`
-	Uris      []string `yaml:"uris" json:"uris"`
-	Env       struct {
-		ServiceTags       string `yaml:"SERVICE_TAGS" json:"SERVICE_TAGS"`
-		BablModule        string `yaml:"BABL_MODULE" json:"BABL_MODULE"`
-		BablModuleVersion string `yaml:"BABL_MODULE_VERSION" json:"BABL_MODULE_VERSION"`
-		BablCommand       string `yaml:"BABL_COMMAND" json:"BABL_COMMAND"`
-		BablKafkaBrokers  string `yaml:"BABL_KAFKA_BROKERS" json:"BABL_KAFKA_BROKERS"`
-	} `yaml:"env" json:"env"`
-	Cmd string `yaml:"cmd" json:"cmd"`
+	Instances             int               `yaml:"instances" json:"instances"`
+	Cpus                  float64           `yaml:"cpus" json:"cpus"`
+	Mem                   *float64          `yaml:"mem" json:"mem"`
+	Disk                  float64           `yaml:"disk" json:"disk,omitempty"`
+	Uris                  []string          `yaml:"uris" json:"uris"`
+	Env                   envVars           `yaml:"env" json:"env"`
+	Secrets               map[string]secret `yaml:"secrets" json:"-"`
+	Profiles              map[string]config `yaml:"profiles" json:"-"`
+	Cmd                   string            `yaml:"cmd" json:"cmd"`
+	Constraints           [][]string        `yaml:"constraints" json:"constraints,omitempty"`
+	Labels                map[string]string `yaml:"labels" json:"labels,omitempty"`
+	AcceptedResourceRoles []string          `yaml:"acceptedResourceRoles" json:"acceptedResourceRoles,omitempty"`
+	HealthChecks          []struct {
+		Protocol  string `yaml:"protocol" json:"protocol"`
+		Path      string `yaml:"path" json:"path,omitempty"`
+		PortIndex int    `yaml:"portIndex" json:"portIndex"`
+		Command   *struct {
+			Value string `yaml:"value" json:"value"`
+		} `yaml:"command" json:"command,omitempty"`
+		GracePeriodSeconds     int `yaml:"gracePeriodSeconds" json:"gracePeriodSeconds,omitempty"`
+		IntervalSeconds        int `yaml:"intervalSeconds" json:"intervalSeconds,omitempty"`
+		TimeoutSeconds         int `yaml:"timeoutSeconds" json:"timeoutSeconds,omitempty"`
+		MaxConsecutiveFailures int `yaml:"maxConsecutiveFailures" json:"maxConsecutiveFailures,omitempty"`
+	} `yaml:"healthChecks" json:"healthChecks,omitempty"`
+	UpgradeStrategy struct {
+		MinimumHealthCapacity *float64 `yaml:"minimumHealthCapacity" json:"minimumHealthCapacity"`
+		MaximumOverCapacity   *float64 `yaml:"maximumOverCapacity" json:"maximumOverCapacity"`
+	} `yaml:"upgradeStrategy" json:"upgradeStrategy"`
+	BackoffSeconds        *float64 `yaml:"backoffSeconds" json:"backoffSeconds"`
+	BackoffFactor         float64  `yaml:"backoffFactor" json:"backoffFactor"`
+	MaxLaunchDelaySeconds *float64 `yaml:"maxLaunchDelaySeconds" json:"maxLaunchDelaySeconds"`
+	ReadinessChecks       []struct {
+		Name                    string `yaml:"name" json:"name,omitempty"`
+		Protocol                string `yaml:"protocol" json:"protocol"`
+		Path                    string `yaml:"path" json:"path"`
+		PortName                string `yaml:"portName" json:"portName"`
+		IntervalSeconds         int    `yaml:"intervalSeconds" json:"intervalSeconds,omitempty"`
+		TimeoutSeconds          int    `yaml:"timeoutSeconds" json:"timeoutSeconds,omitempty"`
+		HttpStatusCodesForReady []int  `yaml:"httpStatusCodesForReady" json:"httpStatusCodesForReady,omitempty"`
+	} `yaml:"readinessChecks" json:"readinessChecks,omitempty"`
+	Marathon struct {
+		Url      string `yaml:"url"`
+		CaBundle string `yaml:"caBundle"`
+	} `yaml:"marathon" json:"-"`
 }
 
-var overwrites config
+// validate rejects settings Marathon would reject.
+func (c config) validate() error {
+	problems := invalidConfig{}
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	inRange := func(name string, value *float64, min, max float64) {
+		if value == nil || (*value >= min && *value <= max) {
+			return
+		}
+		if math.IsInf(max, 1) {
+			add(name, "must be ≥ %g, got %g", min, *value)
+		} else {
+			add(name, "must be between %g and %g, got %g", min, max, *value)
+		}
+	}
+	inRange("upgradeStrategy.minimumHealthCapacity", c.UpgradeStrategy.MinimumHealthCapacity, 0, 1)
+	inRange("upgradeStrategy.maximumOverCapacity", c.UpgradeStrategy.MaximumOverCapacity, 0, 1)
+	inRange("backoffSeconds", c.BackoffSeconds, 0, math.Inf(1))
+	inRange("maxLaunchDelaySeconds", c.MaxLaunchDelaySeconds, 0, math.Inf(1))
+	inRange("mem", c.Mem, 0, math.Inf(1))
+	if c.BackoffFactor < 1 {
+		add("backoffFactor", "must be at least 1, got %g", c.BackoffFactor)
+	}
+	if c.Cpus <= 0 {
+		add("cpus", "must be greater than 0, got %g", c.Cpus)
+	}
+	if c.Instances < 0 {
+		add("instances", "must not be negative, got %d", c.Instances)
+	}
+	if c.Disk < 0 {
+		add("disk", "must not be negative, got %g", c.Disk)
+	}
+
+	switch c.Container.Docker.Network {
+	case "BRIDGE", "HOST", "USER":
+	default:
+		add("container.docker.network", "must be BRIDGE, HOST or USER, got %q", c.Container.Docker.Network)
+	}
+	for i, m := range c.Container.Docker.PortMappings {
+		prefix := fmt.Sprintf("container.docker.portMappings[%d].", i)
+		for name, port := range map[string]int{
+			"containerPort": m.ContainerPort,
+			"hostPort":      m.HostPort,
+			"servicePort":   m.ServicePort,
+		} {
+			if port < 0 || port > 65535 {
+				add(prefix+name, "must be a port between 0 and 65535, got %d", port)
+			}
+		}
+	}
+	for i, v := range c.Container.Volumes {
+		prefix := fmt.Sprintf("container.volumes[%d].", i)
+		if v.Mode != "RO" && v.Mode != "RW" {
+			add(prefix+"mode", "must be RO or RW, got %q", v.Mode)
+		}
+		for name, path := range map[string]string{
+			"hostPath":      v.HostPath,
+			"containerPath": v.ContainerPath,
+		} {
+			if !filepath.IsAbs(path) {
+				add(prefix+name, "must be an absolute path, got %q", path)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Sort(problems)
+		return problems
+	}
+	return nil
+}
+
+// merge applies a layer of settings from babl.yml on top of c.
+func merge(c *config, layer config) {
+	if err := mergo.MergeWithOverwrite(c, layer); err != nil {
+		panic(err)
+	}
+
+	// Merge env variables one by one, keeping explicitly empty values
+	if c.Env == nil {
+		c.Env = envVars{}
+	}
+	for key, value := range layer.Env {
+		c.Env[key] = value
+	}
+
+	// Ugly hack to support unlimited memory usage / zero value
+	if layer.Mem != nil && *layer.Mem == 0 {
+		*c.Mem = 0
+	}
+
+	keepZero(&c.UpgradeStrategy.MinimumHealthCapacity, layer.UpgradeStrategy.MinimumHealthCapacity)
+	keepZero(&c.UpgradeStrategy.MaximumOverCapacity, layer.UpgradeStrategy.MaximumOverCapacity)
+	keepZero(&c.BackoffSeconds, layer.BackoffSeconds)
+	keepZero(&c.MaxLaunchDelaySeconds, layer.MaxLaunchDelaySeconds)
+
+	// An explicitly empty list disables the default health checks
+	if layer.HealthChecks != nil && len(layer.HealthChecks) == 0 {
+		c.HealthChecks = nil
+	}
+}
+
+// keepZero restores explicit zero values from babl.yml which mergo skips.
+func keepZero(merged **float64, local *float64) {
+	if local != nil && *local == 0 {
+		zero := 0.0
+		*merged = &zero
+	}
+}
+
+// defaultsFiles are layered on top of the embedded build-config.yml and
+// below babl.yml, system wide settings first. Missing files are skipped.
+var defaultsFiles = []string{"/etc/babl-build.yml", "~/.babl-build.yml"}
 
-func init() {
-	contents, err := ioutil.ReadFile("babl.yml")
-	if err == nil {
-		_ = yaml.Unmarshal(contents, &overwrites) // ignore error
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
 	}
+	return path
 }
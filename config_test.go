@@ -1,6 +1,9 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -52,7 +55,7 @@ func TestCustomizedCpus(t *testing.T) {
 func TestKafkaBrokers(t *testing.T) {
 	c := execConfigParsed("string-upcase")
 	expected := "queue.babl.sh:9092"
-	actual := c.Env.BablKafkaBrokers
+	actual := c.Env["BABL_KAFKA_BROKERS"]
 	if expected != actual {
 		t.Errorf("config mismatch: want %s; got %s", expected, actual)
 	}
@@ -106,3 +109,268 @@ func TestHostNotUsingPortMappings(t *testing.T) {
 		t.Errorf("config mismatch: want %s; got %s", nil, actual2)
 	}
 }
+
+func TestDefaultHealthCheck(t *testing.T) {
+	c := execConfigParsed("string-upcase")
+	if len(c.HealthChecks) != 1 {
+		t.Fatalf("config mismatch: want 1 health check; got %d", len(c.HealthChecks))
+	}
+	expected := "TCP"
+	actual := c.HealthChecks[0].Protocol
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestCustomizedHealthChecks(t *testing.T) {
+	c := execConfigParsed("health-checks")
+	if len(c.HealthChecks) != 1 {
+		t.Fatalf("config mismatch: want 1 health check; got %d", len(c.HealthChecks))
+	}
+	expected := "/health"
+	actual := c.HealthChecks[0].Path
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "http"
+	actual = c.ReadinessChecks[0].PortName
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestDisabledHealthChecks(t *testing.T) {
+	c := execConfigParsed("no-health-checks")
+	if c.HealthChecks != nil {
+		t.Errorf("config mismatch: want no health checks; got %v", c.HealthChecks)
+	}
+}
+
+func TestNoDefaultHealthCheckWithoutPorts(t *testing.T) {
+	c := execConfigParsed("host-network")
+	if c.HealthChecks != nil {
+		t.Errorf("config mismatch: want no health checks; got %v", c.HealthChecks)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	c := execConfigParsed("placement")
+	expected := 512.0
+	actual := c.Disk
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	c := execConfigParsed("placement")
+	expected := "node_type CLUSTER image-heavy"
+	actual := strings.Join(c.Constraints[1], " ")
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	c := execConfigParsed("placement")
+	expected := "imaging"
+	actual := c.Labels["team"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestAcceptedResourceRoles(t *testing.T) {
+	c := execConfigParsed("placement")
+	expected := "image-heavy"
+	actual := strings.Join(c.AcceptedResourceRoles, ",")
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestDefaultPlacement(t *testing.T) {
+	content := execConfig("string-upcase")
+	output := content.String()
+	for _, key := range []string{"disk", "constraints", "labels", "acceptedResourceRoles"} {
+		if strings.Contains(output, `"`+key+`"`) {
+			t.Errorf("config mismatch: want no %s; got %s", key, output)
+		}
+	}
+}
+
+func TestDefaultUpgradeStrategy(t *testing.T) {
+	c := execConfigParsed("string-upcase")
+	expected := 1.0
+	actual := *c.UpgradeStrategy.MinimumHealthCapacity
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+	expected = 1.15
+	actual = c.BackoffFactor
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+}
+
+func TestZeroUpgradeStrategy(t *testing.T) {
+	c := execConfigParsed("single-instance")
+	expected := 0.0
+	actual := *c.UpgradeStrategy.MinimumHealthCapacity
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+	actual = *c.UpgradeStrategy.MaximumOverCapacity
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+	expected = 300.0
+	actual = *c.MaxLaunchDelaySeconds
+	if expected != actual {
+		t.Errorf("config mismatch: want %f; got %f", expected, actual)
+	}
+}
+
+func TestInvalidUpgradeStrategy(t *testing.T) {
+	c := execConfigParsed("string-upcase")
+	over := 1.5
+	c.UpgradeStrategy.MaximumOverCapacity = &over
+	c.BackoffFactor = 0.5
+	err := c.validate()
+	if err == nil {
+		t.Fatal("config mismatch: want validation error")
+	}
+	for _, field := range []string{"maximumOverCapacity", "backoffFactor"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("validation mismatch: want %s; got %s", field, err)
+		}
+	}
+}
+
+func TestCustomEnv(t *testing.T) {
+	c := execConfigParsed("custom-env")
+	expected := "https://api.example.com"
+	actual := c.Env["API_URL"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "web"
+	actual = c.Env["SERVICE_TAGS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "queue.babl.sh:9092"
+	actual = c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	if value, ok := c.Env["EMPTY"]; !ok || value != "" {
+		t.Errorf("config mismatch: want empty EMPTY; got %q", value)
+	}
+}
+
+func TestEnvForDocker(t *testing.T) {
+	setupFor("custom-env")
+	expected := "-e API_URL=https://api.example.com -e BABL_COMMAND=/bin/app" +
+		" -e BABL_MODULE=larskluge/custom-env" +
+		" -e BABL_MODULE_VERSION=" + version() + " -e EMPTY= -e SERVICE_TAGS=web"
+	args, _ := dockerEnv(false)
+	actual := strings.Join(args, " ")
+	if expected != actual {
+		t.Errorf("env mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestKafkaBrokersForDocker(t *testing.T) {
+	setupFor("custom-env")
+	args, _ := dockerEnv(true)
+	if actual := strings.Join(args, " "); !strings.Contains(actual, "-e BABL_KAFKA_BROKERS=queue.babl.sh:9092") {
+		t.Errorf("env mismatch: want default brokers in production; got %s", actual)
+	}
+
+	os.Setenv("BABL_KAFKA_BROKERS", "localhost:9092")
+	defer os.Unsetenv("BABL_KAFKA_BROKERS")
+	setupFor("interpolation")
+	args, _ = dockerEnv(false)
+	if actual := strings.Join(args, " "); !strings.Contains(actual, "-e BABL_KAFKA_BROKERS=localhost:9092") {
+		t.Errorf("env mismatch: want brokers from babl.yml; got %s", actual)
+	}
+}
+
+func TestBaseWithoutProfile(t *testing.T) {
+	c := execConfigParsed("profiles")
+	if c.Instances != 2 || *c.Mem != 64 {
+		t.Errorf("config mismatch: want 2 instances, 64 mem; got %d, %v", c.Instances, *c.Mem)
+	}
+	if _, ok := c.Labels["BABL_PROFILE"]; ok {
+		t.Errorf("config mismatch: want no BABL_PROFILE label; got %v", c.Labels)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	profile = "production"
+	defer func() { profile = "" }()
+	c := execConfigParsed("profiles")
+	if c.Instances != 3 || *c.Mem != 256 {
+		t.Errorf("config mismatch: want 3 instances, 256 mem; got %d, %v", c.Instances, *c.Mem)
+	}
+	expected := "queue.babl.sh:9092"
+	actual := c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "production"
+	actual = c.Labels["BABL_PROFILE"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestProfileKeepsBase(t *testing.T) {
+	profile = "staging"
+	defer func() { profile = "" }()
+	c := execConfigParsed("profiles")
+	if c.Instances != 1 || *c.Mem != 64 {
+		t.Errorf("config mismatch: want 1 instance, 64 mem; got %d, %v", c.Instances, *c.Mem)
+	}
+	expected := "queue.staging.babl.sh:9092"
+	actual := c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestDefaultsFile(t *testing.T) {
+	defaultsFiles = []string{
+		filepath.Join(testModuleDir(), "../babl-build.yml"),
+		filepath.Join(testModuleDir(), "../missing.yml"),
+	}
+	defer func() { defaultsFiles = nil }()
+	c := execConfigParsed("string-upcase")
+	expected := "registry.example.com/larskluge/string-upcase:v20"
+	actual := c.Container.Docker.Image
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "kafka.example.com:9092"
+	actual = c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "gelf-address=udp://logs.example.com:4988"
+	actual = c.Container.Docker.Parameters[1].Value
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestBablYmlOverridesDefaultsFile(t *testing.T) {
+	defaultsFiles = []string{filepath.Join(testModuleDir(), "../babl-build.yml")}
+	defer func() { defaultsFiles = nil }()
+	c := execConfigParsed("profiles")
+	expected := "queue.staging.babl.sh:9092"
+	actual := c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
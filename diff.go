@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type fieldDiff struct {
+	Path   string
+	Remote string
+	Local  string
+}
+
+// flatten turns a config, or its JSON definition, into a map from field
+// paths like "container.docker.image" or "container.volumes[0].mode" to
+// their values.
+func flatten(c interface{}) map[string]string {
+	blob, err := json.Marshal(c)
+	check(err)
+	var tree interface{}
+	check(json.Unmarshal(blob, &tree))
+
+	fields := map[string]string{}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, value)
+			}
+		case []interface{}:
+			for i, value := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), value)
+			}
+		case nil:
+		default:
+			fields[prefix] = fmt.Sprint(v)
+		}
+	}
+	walk("", tree)
+	return fields
+}
+
+// normalize writes fields of a deployed or local config the way both sides
+// can be compared: ids without Marathon's leading slash and the container
+// type Marathon assumes if none is given.
+func normalize(c *config) {
+	c.Id = strings.TrimPrefix(c.Id, "/")
+	if c.Container.Type == "" {
+		c.Container.Type = "DOCKER"
+	}
+}
+
+// defaulted tells whether a field only present in the deployed config was
+// most likely filled in by Marathon, i.e. the local config leaves it unset
+// in a list element it does define (e.g. a port mapping's servicePort).
+func defaulted(path string, local map[string]string) bool {
+	i := strings.LastIndex(path, "].")
+	if i < 0 {
+		return false
+	}
+	element := path[:i+2]
+	for p := range local {
+		if strings.HasPrefix(p, element) {
+			return true
+		}
+	}
+	return false
+}
+
+// configDiff lists all fields whose value differs between the deployed and
+// the local config, sorted by path.
+func configDiff(remote, local config) []fieldDiff {
+	normalize(&remote)
+	normalize(&local)
+	remote.Container.Options = local.Container.Options // not kept by Marathon
+	r, l := flatten(remote), flatten(local)
+
+	paths := []string{}
+	for path := range r {
+		paths = append(paths, path)
+	}
+	for path := range l {
+		if _, ok := r[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	diffs := []fieldDiff{}
+	for _, path := range paths {
+		remoteValue, inRemote := r[path]
+		localValue, inLocal := l[path]
+		if !inLocal && defaulted(path, l) {
+			continue
+		}
+		if remoteValue != localValue || inRemote != inLocal {
+			if !inRemote {
+				remoteValue = "-"
+			}
+			if !inLocal {
+				localValue = "-"
+			}
+			diffs = append(diffs, fieldDiff{path, remoteValue, localValue})
+		}
+	}
+	return diffs
+}
+
+// deployedDiff compares the deployed definition of an app to the local
+// config, secrets masked on both sides.
+func deployedDiff(appId string) ([]fieldDiff, error) {
+	remote, err := appDefinition(appId)
+	if err != nil {
+		return nil, err
+	}
+	local, err := localDefinition()
+	if err != nil {
+		return nil, err
+	}
+	maskSecrets(&remote, conf())
+	return configDiff(remote, local), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigDiffIdentical(t *testing.T) {
+	c := execConfigParsed("string-upcase")
+	diffs := configDiff(c, c)
+	if len(diffs) != 0 {
+		t.Errorf("diff mismatch: want none; got %v", diffs)
+	}
+}
+
+func TestConfigDiffChangedFields(t *testing.T) {
+	local := execConfigParsed("image-resize")
+	remote := execConfigParsed("image-resize")
+	remote.Cpus = 0.1
+	remote.Container.Docker.Image = "registry.babl.sh/larskluge/image-resize:v1"
+	remote.Container.Docker.PortMappings[0].ServicePort = 10001
+	remote.Container.Docker.PortMappings[0].Protocol = "tcp"
+
+	diffs := configDiff(remote, local)
+	if len(diffs) != 2 {
+		t.Fatalf("diff mismatch: want 2 fields; got %v", diffs)
+	}
+	if diffs[0].Path != "container.docker.image" || diffs[0].Remote != remote.Container.Docker.Image {
+		t.Errorf("diff mismatch: want container.docker.image; got %v", diffs[0])
+	}
+	if diffs[1].Path != "cpus" || diffs[1].Remote != "0.1" || diffs[1].Local != "0.6" {
+		t.Errorf("diff mismatch: want cpus 0.1 -> 0.6; got %v", diffs[1])
+	}
+}
+
+func TestConfigDiffRemovedVolume(t *testing.T) {
+	local := execConfigParsed("babl-build")
+	remote := execConfigParsed("babl-build")
+	local.Container.Volumes = local.Container.Volumes[:len(local.Container.Volumes)-1]
+
+	diffs := configDiff(remote, local)
+	if len(diffs) != 3 {
+		t.Fatalf("diff mismatch: want 3 fields; got %v", diffs)
+	}
+	for _, d := range diffs {
+		if d.Local != "-" {
+			t.Errorf("diff mismatch: want removed field; got %v", d)
+		}
+	}
+}
+
+func TestConfigDiffNormalizesIdAndType(t *testing.T) {
+	local := execConfigParsed("string-upcase")
+	remote := execConfigParsed("string-upcase")
+	remote.Id = "/" + remote.Id
+	local.Container.Type = ""
+
+	if diffs := configDiff(remote, local); len(diffs) != 0 {
+		t.Errorf("diff mismatch: want none; got %v", diffs)
+	}
+}
+
+// deployedApp is GET /v2/apps/larskluge/string-upcase of Marathon 1.4 after
+// deploying the string-upcase fixture, the image filled in by the test.
+const deployedApp = `{"app": {
+  "id": "/larskluge/string-upcase",
+  "cmd": "babl-server",
+  "args": null,
+  "user": null,
+  "env": {
+    "BABL_MODULE_VERSION": "%[2]s",
+    "SERVICE_TAGS": "babl",
+    "BABL_KAFKA_BROKERS": "queue.babl.sh:9092",
+    "BABL_COMMAND": "/bin/app",
+    "BABL_MODULE": "larskluge/string-upcase"
+  },
+  "instances": 1,
+  "cpus": 0.1,
+  "mem": 16,
+  "disk": 0,
+  "gpus": 0,
+  "executor": "",
+  "constraints": [],
+  "uris": [],
+  "fetch": [],
+  "storeUrls": [],
+  "backoffSeconds": 1,
+  "backoffFactor": 1.15,
+  "maxLaunchDelaySeconds": 3600,
+  "container": {
+    "type": "DOCKER",
+    "volumes": [],
+    "docker": {
+      "image": "%[1]s",
+      "network": "BRIDGE",
+      "portMappings": [
+        {"containerPort": 0, "hostPort": 0, "servicePort": 10104, "protocol": "tcp", "labels": {}}
+      ],
+      "privileged": false,
+      "parameters": [
+        {"key": "log-driver", "value": "gelf"},
+        {"key": "log-opt", "value": "gelf-address=udp://babl-satellite1:4988"},
+        {"key": "log-opt", "value": "env=BABL_MODULE,BABL_MODULE_VERSION,SERVICE_TAGS"}
+      ],
+      "forcePullImage": false
+    }
+  },
+  "healthChecks": [
+    {"gracePeriodSeconds": 60, "intervalSeconds": 30, "timeoutSeconds": 10,
+     "maxConsecutiveFailures": 3, "portIndex": 0, "delaySeconds": 15,
+     "protocol": "TCP", "ignoreHttp1xx": false}
+  ],
+  "readinessChecks": [],
+  "dependencies": [],
+  "upgradeStrategy": {"minimumHealthCapacity": 1, "maximumOverCapacity": 1},
+  "labels": {},
+  "ipAddress": null,
+  "version": "2026-10-18T10:00:00.000Z",
+  "residency": null,
+  "secrets": {},
+  "taskKillGracePeriodSeconds": null,
+  "unreachableStrategy": {"inactiveAfterSeconds": 300, "expungeAfterSeconds": 600},
+  "killSelection": "YOUNGEST_FIRST",
+  "acceptedResourceRoles": null,
+  "ports": [10104],
+  "portDefinitions": [{"port": 10104, "protocol": "tcp", "name": "default", "labels": {}}],
+  "requirePorts": false,
+  "versionInfo": {"lastScalingAt": "2026-10-18T10:00:00.000Z", "lastConfigChangeAt": "2026-10-18T10:00:00.000Z"},
+  "tasksStaged": 0,
+  "tasksRunning": 1,
+  "tasksHealthy": 1,
+  "tasksUnhealthy": 0,
+  "deployments": []
+}}`
+
+func TestDeployedDiff(t *testing.T) {
+	setupFor("string-upcase")
+	image := conf().Container.Docker.Image
+	server := newFakeMarathon(map[string][]string{
+		"GET /v2/apps/larskluge/string-upcase": {fmt.Sprintf(deployedApp, image, version())},
+	})
+	defer server.Close()
+
+	withMarathon(server.URL, func() {
+		diffs, err := deployedDiff(id())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != 0 {
+			t.Errorf("diff mismatch: want none; got %v", diffs)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// origin tells where the value of a config field comes from, e.g. the
+// embedded defaults, babl.yml or a rule babl-build applies, and which
+// rewrite was applied to it.
+type origin struct {
+	Source  string
+	Note    string
+	Removed bool
+}
+
+var _origins map[string]origin // origins of conf()'s result, by field path
+
+// provenance keeps track of the origins of all fields while conf() layers
+// its sources.
+type provenance struct {
+	origins map[string]origin
+	fields  map[string]string
+}
+
+func newProvenance(c config) *provenance {
+	p := &provenance{origins: map[string]origin{}, fields: flatten(c)}
+	for path := range p.fields {
+		p.origins[path] = origin{Source: "default"}
+	}
+	return p
+}
+
+// update attributes all fields of c which changed since the last update to
+// source, as well as fields the given layer sets to their current value.
+func (p *provenance) update(source, note string, c config, layer *config) {
+	set := map[string]string{}
+	if layer != nil {
+		set = flatten(*layer)
+	}
+	fields := flatten(c)
+	for path, value := range fields {
+		old, existed := p.fields[path]
+		given, inLayer := set[path]
+		if !existed || old != value || (inLayer && given == value) {
+			p.origins[path] = origin{Source: source, Note: note}
+		}
+	}
+	for path := range p.fields {
+		if _, ok := fields[path]; !ok {
+			p.origins[path] = origin{Source: source, Note: note, Removed: true}
+		}
+	}
+	p.fields = fields
+}
+
+// merged records the result of merge(c, layer) for the given source.
+func (p *provenance) merged(source string, c config, layer config) {
+	p.update(source, "", c, &layer)
+	if layer.Mem != nil && *layer.Mem == 0 {
+		p.origins["mem"] = origin{Source: source, Note: "explicit 0 kept, unlimited memory"}
+	}
+}
+
+// rule records the fields changed by one of the rules conf() applies.
+func (p *provenance) rule(note string, c config) {
+	p.update("rule", note, c, nil)
+}
+
+// fromDefaults tells whether all fields of the list at the given path, like
+// "healthChecks", still hold the embedded defaults.
+func (p *provenance) fromDefaults(list string) bool {
+	for path, o := range p.origins {
+		if strings.HasPrefix(path, list+"[") && o.Source != "default" {
+			return false
+		}
+	}
+	return true
+}
+
+// explain prints every field of the app definition next to its origin,
+// including fields removed by a rule.
+func explain(def map[string]interface{}) {
+	fields := flatten(def)
+	paths := []string{}
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	for path, o := range _origins {
+		if _, ok := fields[path]; !ok && o.Removed {
+			fields[path] = "-"
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	pathLen, valueLen := 0, 0
+	for _, path := range paths {
+		if len(path) > pathLen {
+			pathLen = len(path)
+		}
+		if len(fields[path]) > valueLen {
+			valueLen = len(fields[path])
+		}
+	}
+	for _, path := range paths {
+		o, ok := _origins[path]
+		if !ok {
+			o = origin{Source: "secrets"}
+		}
+		source := o.Source
+		if o.Removed {
+			source += ", removed"
+		}
+		if o.Note != "" {
+			source += ": " + o.Note
+		}
+		fmt.Fprintf(stdout, "%-*s  %-*s  # %s\n", pathLen, path, valueLen, fields[path], source)
+	}
+}
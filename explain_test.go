@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func execExplain(module string) string {
+	setupFor(module)
+	var buf bytes.Buffer
+	stdout = &buf
+	commands["config"].Func("--explain")
+	stdout = os.Stdout
+	return buf.String()
+}
+
+func explained(output, path string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == path {
+			return line[strings.Index(line, "# ")+2:]
+		}
+	}
+	return ""
+}
+
+func TestExplainSources(t *testing.T) {
+	output := execExplain("image-resize")
+	for path, expected := range map[string]string{
+		"cpus":                                "babl.yml",
+		"mem":                                 "babl.yml",
+		"instances":                           "default",
+		"container.docker.image":              "rule: computed from registry, id and git version",
+		"env.BABL_MODULE_VERSION":             "rule: computed from registry, id and git version",
+		"container.docker.network":            "default",
+		"healthChecks[0].portIndex":           "default",
+		"env.BABL_KAFKA_BROKERS":              "default",
+		"upgradeStrategy.maximumOverCapacity": "default",
+	} {
+		if actual := explained(output, path); expected != actual {
+			t.Errorf("origin mismatch for %s: want %s; got %s", path, expected, actual)
+		}
+	}
+}
+
+func TestExplainRules(t *testing.T) {
+	output := execExplain("custom-env")
+	expected := "rule: GELF port 4990 for web services"
+	actual := explained(output, "container.docker.parameters[1].value")
+	if expected != actual {
+		t.Errorf("origin mismatch: want %s; got %s", expected, actual)
+	}
+
+	output = execExplain("unlimited-mem")
+	expected = "babl.yml: explicit 0 kept, unlimited memory"
+	actual = explained(output, "mem")
+	if expected != actual {
+		t.Errorf("origin mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestExplainRemovedPortMappings(t *testing.T) {
+	output := execExplain("host-network")
+	expected := "rule, removed: no port mappings with HOST network"
+	actual := explained(output, "container.docker.portMappings[0].hostPort")
+	if expected != actual {
+		t.Errorf("origin mismatch: want %s; got %s", expected, actual)
+	}
+}
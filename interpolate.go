@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches $$ as well as ${VAR}, ${VAR-default},
+// ${VAR:-default}, ${VAR?error} and ${VAR:?error}.
+var variablePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}`)
+
+// interpolate expands environment variables in all strings of v, the way
+// shells and docker-compose do. Variables required with ? but not set are
+// all listed in the returned error.
+func interpolate(v interface{}, file string) error {
+	missing := []string{}
+	expandStrings(reflect.ValueOf(v), &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing required variables in %s:\n  %s",
+			file, strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+func expandStrings(v reflect.Value, missing *[]string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(expand(v.String(), missing))
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			expandStrings(v.Elem(), missing)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandStrings(v.Field(i), missing)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandStrings(v.Index(i), missing)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			entry := reflect.New(v.Type().Elem()).Elem()
+			entry.Set(v.MapIndex(key))
+			expandStrings(entry, missing)
+			v.SetMapIndex(key, entry)
+		}
+	}
+}
+
+func expand(s string, missing *[]string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		m := variablePattern.FindStringSubmatch(match)
+		name, op, arg := m[1], m[2], m[3]
+		value, set := os.LookupEnv(name)
+		if strings.HasPrefix(op, ":") && value == "" {
+			set = false
+		}
+		if set {
+			return value
+		}
+		switch strings.TrimPrefix(op, ":") {
+		case "-":
+			return arg
+		case "?":
+			if arg == "" {
+				arg = "not set"
+			}
+			for _, m := range *missing {
+				if m == name+": "+arg {
+					return ""
+				}
+			}
+			*missing = append(*missing, name+": "+arg)
+		}
+		return ""
+	})
+}
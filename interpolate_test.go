@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolation(t *testing.T) {
+	os.Setenv("API_HOST", "api.example.com")
+	defer os.Unsetenv("API_HOST")
+	c := execConfigParsed("interpolation")
+	for path, expected := range map[string]string{
+		"Env.BABL_KAFKA_BROKERS": "queue.babl.sh:9092",
+		"Env.API_URL":            "https://api.example.com/v1",
+		"Env.PRICE":              "$5",
+		"Labels.TEAM":            "core",
+	} {
+		field, key := splitPath(path)
+		actual := reflect.ValueOf(c).FieldByName(field).MapIndex(reflect.ValueOf(key)).String()
+		if expected != actual {
+			t.Errorf("config mismatch for %s: want %s; got %s", path, expected, actual)
+		}
+	}
+}
+
+func TestInterpolationOverriddenDefault(t *testing.T) {
+	os.Setenv("BABL_KAFKA_BROKERS", "kafka.example.com:9092")
+	defer os.Unsetenv("BABL_KAFKA_BROKERS")
+	c := execConfigParsed("interpolation")
+	expected := "kafka.example.com:9092"
+	actual := c.Env["BABL_KAFKA_BROKERS"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestInterpolationMissingVariables(t *testing.T) {
+	os.Setenv("EMPTY", "")
+	defer os.Unsetenv("EMPTY")
+	var c config
+	c.Id = "${MODULE_ID:?needed for the image name}"
+	c.Cmd = "${EMPTY:?}${EMPTY?}"
+	c.Uris = []string{"${MODULE_ID:?needed for the image name}"}
+	err := interpolate(&c, "babl.yml")
+	expected := "Missing required variables in babl.yml:\n" +
+		"  MODULE_ID: needed for the image name\n" +
+		"  EMPTY: not set"
+	if err == nil || err.Error() != expected {
+		t.Errorf("error mismatch: want %s; got %v", expected, err)
+	}
+}
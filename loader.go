@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// moduleDirectory is the directory of the module to work on, given by
+// --dir, the directory of --file or the current one.
+func moduleDirectory() string {
+	if moduleDir != "" {
+		return moduleDir
+	}
+	if configFile != "" {
+		return filepath.Dir(configFile)
+	}
+	return "."
+}
+
+// manifestNames are the names the manifest of a module may have.
+var manifestNames = []string{"babl.yml", "babl.yaml", "babl.json", "babl.toml"}
+
+// findManifest returns the one manifest in dir, or babl.yml if there is
+// none at all.
+func findManifest(dir string) (string, error) {
+	found := []string{}
+	for _, name := range manifestNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return filepath.Join(dir, "babl.yml"), nil
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("More than one manifest found, keep only one of %s",
+		strings.Join(found, ", "))
+}
+
+// manifestPath is the manifest of the module, given by --file or found in
+// the module directory.
+func manifestPath() string {
+	if configFile != "" {
+		return configFile
+	}
+	path, err := findManifest(moduleDirectory())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return path
+}
+
+// readManifest returns the contents of a manifest or defaults file as YAML,
+// converting JSON and TOML files.
+func readManifest(file string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil || !converted(file) {
+		return contents, err
+	}
+	var tree map[string]interface{}
+	if filepath.Ext(file) == ".json" {
+		err = json.Unmarshal(contents, &tree)
+	} else {
+		_, err = toml.Decode(string(contents), &tree)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return yaml.Marshal(tree)
+}
+
+// converted tells whether readManifest converts the given file to YAML, so
+// lines in the YAML do not match the ones of the file.
+func converted(file string) bool {
+	ext := filepath.Ext(file)
+	return ext == ".json" || ext == ".toml"
+}
+
+// gitVersion returns the version of the module in dir, counting the commits
+// of its git repository. Modules without commits are at v0.
+func gitVersion(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-list", "HEAD", "--count")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err == nil {
+		return "v" + strings.TrimSpace(string(output)), nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if exitErr.Sys().(syscall.WaitStatus).ExitStatus() == 128 {
+			return "v0", nil
+		}
+	}
+	return "", err
+}
+
+// readLayer reads a file of config settings and expands the variables in it.
+func readLayer(file string) (config, error) {
+	var layer config
+	contents, err := readManifest(file)
+	if err != nil {
+		return layer, err
+	}
+	if err := yaml.Unmarshal(contents, &layer); err != nil {
+		return layer, fmt.Errorf("%s: %s", file, err)
+	}
+	return layer, interpolate(&layer, file)
+}
+
+// loadConfig layers the embedded defaults, the defaults files, the module's
+// manifest file, the selected profile and --set overrides, and applies the
+// rules babl-build has for some settings. It returns the resulting config
+// of the module in dir along with the origin of each field.
+func loadConfig(dir, file string) (config, map[string]origin, error) {
+	var c config
+	contents, err := Asset("build-config.yml")
+	if err != nil {
+		panic(err)
+	}
+	if err := yaml.Unmarshal(contents, &c); err != nil {
+		panic(err)
+	}
+	trace := newProvenance(c)
+	for _, path := range defaultsFiles {
+		path = expandHome(path)
+		defaults, err := readLayer(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return c, nil, err
+		}
+		merge(&c, defaults)
+		trace.merged(path, c, defaults)
+	}
+
+	local, err := readLayer(file)
+	if err != nil {
+		return c, nil, err
+	}
+	merge(&c, local)
+	trace.merged(file, c, local)
+	if profile != "" {
+		layer, ok := local.Profiles[profile]
+		if !ok {
+			return c, nil, fmt.Errorf("Profile %q not found in %s", profile, file)
+		}
+		merge(&c, layer)
+		trace.merged("profile "+profile, c, layer)
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		c.Labels["BABL_PROFILE"] = profile
+		trace.rule("selected profile", c)
+	}
+	if err := applySets(&c, sets); err != nil {
+		return c, nil, err
+	}
+	trace.update("--set", "", c, nil)
+
+	if c.Env["SERVICE_TAGS"] == "web" {
+		reg := regexp.MustCompile(":4[0-9]+$")
+		for i := 0; i < len(c.Container.Docker.Parameters); i++ {
+			param := &c.Container.Docker.Parameters[i]
+			if param.Key == "log-opt" {
+				param.Value = reg.ReplaceAllString(param.Value, ":4990")
+			}
+		}
+		trace.rule("GELF port 4990 for web services", c)
+	}
+
+	if c.Container.Docker.Network == "HOST" {
+		c.Container.Docker.PortMappings = nil
+		trace.rule("no port mappings with HOST network", c)
+	}
+
+	// The default TCP check needs a port mapping to check
+	if len(c.Container.Docker.PortMappings) == 0 && trace.fromDefaults("healthChecks") {
+		c.HealthChecks = nil
+		trace.rule("no default health check without port mappings", c)
+	}
+
+	version, err := gitVersion(dir)
+	if err != nil {
+		return c, nil, err
+	}
+	c.Container.Docker.Image = fmt.Sprintf("%s/%s:%s", c.Registry, c.Id, version)
+	c.Env["BABL_MODULE"] = c.Id
+	c.Env["BABL_MODULE_VERSION"] = version
+	trace.rule("computed from registry, id and git version", c)
+	return c, trace.origins, nil
+}
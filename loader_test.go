@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromOtherDirectory(t *testing.T) {
+	setupFor("image-resize")
+	dir := testModuleDirFor("string-upcase")
+	c, _, err := loadConfig(dir, filepath.Join(dir, "babl.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "registry.babl.sh/larskluge/string-upcase:v20"
+	actual := c.Container.Docker.Image
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestFileFlag(t *testing.T) {
+	setupFor("image-resize")
+	configFile = filepath.Join(testModuleDirFor("string-upcase"), "babl.yml")
+	defer func() { configFile = "" }()
+	expected := "larskluge/string-upcase"
+	actual := id()
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "v20"
+	actual = version()
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestDirFlag(t *testing.T) {
+	setupFor("image-resize")
+	moduleDir = testModuleDirFor("unlimited-mem")
+	defer func() { moduleDir = "" }()
+	c := conf()
+	if *c.Mem != 0 {
+		t.Errorf("config mismatch: want 0 mem; got %v", *c.Mem)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	setupFor("image-resize")
+	dir := testModuleDirFor("profiles")
+	profile = "qa"
+	defer func() { profile = "" }()
+	_, _, err := loadConfig(dir, filepath.Join(dir, "babl.yml"))
+	if err == nil || !strings.Contains(err.Error(), `Profile "qa" not found`) {
+		t.Errorf("error mismatch: want unknown profile; got %v", err)
+	}
+	_, _, err = loadConfig(dir, filepath.Join(dir, "missing.yml"))
+	if err == nil {
+		t.Error("error mismatch: want missing file error")
+	}
+}
+
+func TestManifestFormats(t *testing.T) {
+	for _, module := range []string{"json-manifest", "toml-manifest"} {
+		c := execConfigParsed(module)
+		expected := "larskluge/" + module
+		actual := c.Id
+		if expected != actual {
+			t.Errorf("config mismatch: want %s; got %s", expected, actual)
+		}
+		expected = "https://api.example.com"
+		actual = c.Env["API_URL"]
+		if expected != actual {
+			t.Errorf("config mismatch: want %s; got %s", expected, actual)
+		}
+		if *c.Mem != 0 || *c.UpgradeStrategy.MinimumHealthCapacity != 0 {
+			t.Errorf("config mismatch: want explicit zeros kept in %s; got %v, %v",
+				module, *c.Mem, *c.UpgradeStrategy.MinimumHealthCapacity)
+		}
+		if c.Cpus != 0.25 {
+			t.Errorf("config mismatch: want 0.25 cpus in %s; got %v", module, c.Cpus)
+		}
+	}
+}
+
+func TestTomlManifest(t *testing.T) {
+	profile = "production"
+	defer func() { profile = "" }()
+	c := execConfigParsed("toml-manifest")
+	if c.Instances != 3 {
+		t.Errorf("config mismatch: want 3 instances; got %d", c.Instances)
+	}
+	expected := "/var/run/docker.sock"
+	actual := c.Container.Volumes[0].HostPath
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestMoreThanOneManifest(t *testing.T) {
+	_, err := findManifest(testModuleDirFor("two-manifests"))
+	if err == nil || !strings.Contains(err.Error(), "babl.yml") || !strings.Contains(err.Error(), "babl.json") {
+		t.Errorf("error mismatch: want both manifests listed; got %v", err)
+	}
+}
+
+func TestJsonManifestProblems(t *testing.T) {
+	actual := []string{}
+	for _, p := range strictProblems("babl.json", []byte("{\n  \"id\": \"x\",\n  \"memory\": 64\n}\n")) {
+		actual = append(actual, p.String())
+	}
+	assertProblems(t, []string{"babl.json: field memory not found in type main.config"}, actual)
+}
+
+func TestJsonEscapedSlashes(t *testing.T) {
+	c := execConfigParsed("json-escaped-slashes")
+	expected := "larskluge/json-escaped-slashes"
+	actual := c.Id
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "https://example.com/app.tgz"
+	actual = c.Uris[0]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "https://api.example.com/v1"
+	actual = c.Env["API_URL"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestJsonDuplicateKey(t *testing.T) {
+	c := execConfigParsed("json-duplicate-key")
+	if c.Instances != 3 {
+		t.Errorf("config mismatch: want the last of duplicate keys, 3 instances; got %d", c.Instances)
+	}
+}
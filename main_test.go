@@ -3,12 +3,18 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 )
 
+func init() {
+	defaultsFiles = nil // do not pick up the defaults of the machine running the tests
+}
+
 func testModuleDir() string {
 	_, filename, _, _ := runtime.Caller(1)
 	p, _ := filepath.Abs(path.Join(path.Dir(filename), "test/fixtures/modules"))
@@ -43,3 +49,24 @@ func execConfigParsed(module string) (c config) {
 	check(err)
 	return
 }
+
+// captureStderr returns what f writes to stderr, including log output.
+func captureStderr(f func()) string {
+	r, w, err := os.Pipe()
+	check(err)
+	stderr := os.Stderr
+	os.Stderr = w
+	log.SetOutput(w)
+	defer func() {
+		os.Stderr = stderr
+		log.SetOutput(stderr)
+	}()
+	done := make(chan []byte)
+	go func() {
+		output, _ := ioutil.ReadAll(r)
+		done <- output
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/babl/babl-build/marathon"
+)
+
+var pollInterval = 2 * time.Second
+
+var _client *marathon.Client = nil // cache marathonClient()'s result
+
+// marathonURLs lists the Marathon masters to try in order, taken from
+// --marathon-url, an explicitly given --marathon-host, $MARATHON_URL,
+// babl.yml or the default --marathon-host.
+func marathonURLs() []string {
+	urls := marathonUrl
+	if urls == "" && flagPassed("marathon-host") {
+		urls = fmt.Sprintf("http://%s:8080", marathonHost)
+	}
+	if urls == "" {
+		urls = firstOf(os.Getenv("MARATHON_URL"), conf().Marathon.Url)
+	}
+	if urls == "" {
+		urls = fmt.Sprintf("http://%s:8080", marathonHost)
+	}
+	return marathon.New(strings.Split(urls, ",")...).URLs
+}
+
+// flagPassed tells whether the flag with the given name was given on the
+// command line, rather than left at its default.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// firstOf returns the first non-empty value.
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// httpClient returns the HTTP client used for all Marathon requests,
+// trusting the CA bundle from --marathon-ca, $MARATHON_CA or babl.yml and
+// presenting the client certificate from --marathon-cert/--marathon-key.
+func httpClient() (*http.Client, error) {
+	caBundle := firstOf(marathonCa, os.Getenv("MARATHON_CA"))
+	if caBundle == "" {
+		caBundle = conf().Marathon.CaBundle
+	}
+	cert := firstOf(marathonCert, os.Getenv("MARATHON_CERT"))
+	key := firstOf(marathonKey, os.Getenv("MARATHON_KEY"), cert)
+	if caBundle == "" && cert == "" {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if caBundle != "" {
+		pem, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", caBundle)
+		}
+	}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// bearerToken returns the bearer token from --marathon-token,
+// $MARATHON_TOKEN or the file given by --marathon-token-file or
+// $MARATHON_TOKEN_FILE.
+func bearerToken() (string, error) {
+	if token := firstOf(marathonToken, os.Getenv("MARATHON_TOKEN")); token != "" {
+		return token, nil
+	}
+	file := firstOf(marathonTokenFile, os.Getenv("MARATHON_TOKEN_FILE"))
+	if file == "" {
+		return "", nil
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// marathonClient returns the Marathon client configured by the command
+// line, environment and babl.yml. With --dry-run only GET requests are
+// sent, all others are printed.
+func marathonClient() *marathon.Client {
+	if _client != nil {
+		return _client
+	}
+
+	c := marathon.New(marathonURLs()...)
+	c.Timeout = marathonTimeout
+	var err error
+	if c.HTTPClient, err = httpClient(); err != nil {
+		log.Fatal(err)
+	}
+	if c.Token, err = bearerToken(); err != nil {
+		log.Fatal(err)
+	}
+	c.User = firstOf(marathonUser, os.Getenv("MARATHON_USER"))
+	c.Password = firstOf(marathonPassword, os.Getenv("MARATHON_PASSWORD"))
+	if dryRun {
+		c.DryRun = stdout
+	}
+
+	_client = c
+	return c
+}
+
+// appExists tells whether Marathon already knows an app with the given id.
+func appExists(appId string) (bool, error) {
+	_, err := marathonClient().App(context.Background(), appId)
+	if marathon.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// appStatus is the live state of an app in Marathon next to the version
+// which would be deployed from the local checkout.
+type appStatus struct {
+	Id              string                `json:"id"`
+	Image           string                `json:"image"`
+	DeployedVersion string                `json:"deployedVersion"`
+	LocalVersion    string                `json:"localVersion"`
+	Profile         string                `json:"profile,omitempty"`
+	Instances       int                   `json:"instances"`
+	Running         int                   `json:"running"`
+	Staged          int                   `json:"staged"`
+	Healthy         int                   `json:"healthy"`
+	Unhealthy       int                   `json:"unhealthy"`
+	Tasks           []marathon.Task       `json:"tasks"`
+	Deployments     []marathon.Deployment `json:"deployments"`
+}
+
+func fetchStatus(appId string) (appStatus, error) {
+	ctx := context.Background()
+	app, err := marathonClient().App(ctx, appId, "apps.tasks")
+	if err != nil {
+		return appStatus{}, err
+	}
+	status := appStatus{
+		Id:           app.Id,
+		Image:        app.Container.Docker.Image,
+		LocalVersion: version(),
+		Profile:      app.Labels["BABL_PROFILE"],
+		Instances:    app.Instances,
+		Running:      app.TasksRunning,
+		Staged:       app.TasksStaged,
+		Healthy:      app.TasksHealthy,
+		Unhealthy:    app.TasksUnhealthy,
+		Tasks:        app.Tasks,
+		Deployments:  []marathon.Deployment{},
+	}
+	if i := strings.LastIndex(status.Image, ":"); i >= 0 {
+		status.DeployedVersion = status.Image[i+1:]
+	}
+	for _, d := range app.Deployments {
+		deployment, err := marathonClient().Deployment(ctx, d.Id)
+		if err != nil {
+			return status, err
+		}
+		if deployment != nil {
+			status.Deployments = append(status.Deployments, *deployment)
+		}
+	}
+	return status, nil
+}
+
+// appDefinition fetches the currently deployed definition of an app.
+func appDefinition(appId string) (config, error) {
+	var c config
+	err := marathonClient().AppDefinition(context.Background(), appId, &c)
+	return c, err
+}
+
+// appVersion fetches the app definition deployed at the given timestamp.
+func appVersion(appId, timestamp string) (config, error) {
+	var c config
+	err := marathonClient().AppVersion(context.Background(), appId, timestamp, &c)
+	return c, err
+}
+
+// rollbackTarget finds the newest deployed version of an app with the given
+// module version, like "v19", or the newest one before the current module
+// version if wanted is empty. It returns the module version along with the
+// Marathon version timestamp.
+func rollbackTarget(appId, wanted string) (string, string, error) {
+	timestamps, err := marathonClient().AppVersions(context.Background(), appId)
+	if err != nil {
+		return "", "", err
+	}
+	if len(timestamps) == 0 {
+		return "", "", fmt.Errorf("No versions of %s found", appId)
+	}
+	current, err := appVersion(appId, timestamps[0])
+	if err != nil {
+		return "", "", err
+	}
+	currentVersion := current.Env["BABL_MODULE_VERSION"]
+	if wanted != "" && wanted == currentVersion {
+		return "", "", fmt.Errorf("Version %s of %s is already deployed", wanted, appId)
+	}
+
+	for _, timestamp := range timestamps[1:] {
+		c, err := appVersion(appId, timestamp)
+		if err != nil {
+			return "", "", err
+		}
+		v := c.Env["BABL_MODULE_VERSION"]
+		if (wanted != "" && v == wanted) || (wanted == "" && v != currentVersion) {
+			return v, timestamp, nil
+		}
+	}
+	if wanted != "" {
+		return "", "", fmt.Errorf("Version %s of %s not found", wanted, appId)
+	}
+	return "", "", fmt.Errorf("No previous version of %s found", appId)
+}
+
+// awaitDeployment sends a change of the current app with send and waits
+// for the deployment it starts to finish, exiting non-zero if it fails or
+// --deploy-timeout passed. With --follow, the app's events are subscribed
+// to before the change is sent, so none of them are missed. It returns
+// right away when --no-wait or --dry-run is given.
+func awaitDeployment(send func() (marathon.DeploymentRef, error)) {
+	var events *marathon.EventStream
+	if follow && !noWait && !dryRun {
+		var err error
+		if events, err = marathonClient().Subscribe(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		defer events.Close()
+	}
+
+	ref, err := send()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dryRun {
+		return
+	}
+	if noWait {
+		fmt.Fprintf(os.Stderr, "Deployment %s started\n", ref.Id)
+		return
+	}
+	if err := waitForDeployment(ref, events); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// waitForDeployment polls Marathon until the given deployment is gone from
+// the list of running deployments, printing the app's events if a
+// subscription is given. If it fails or does not finish within
+// --deploy-timeout, the failed tasks are reported.
+func waitForDeployment(ref marathon.DeploymentRef, events *marathon.EventStream) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deployTimeout)
+	defer cancel()
+	failed := make(chan string, 1)
+	if events != nil {
+		go followEvents(ctx, events, ref.Id, failed)
+	}
+	lastStep := -1
+	for {
+		d, err := marathonClient().Deployment(ctx, ref.Id)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if err == nil && d == nil {
+			fmt.Fprintf(os.Stderr, "Deployment %s finished\n", ref.Id)
+			return nil
+		}
+		if d != nil && d.CurrentStep != lastStep {
+			lastStep = d.CurrentStep
+			actions := []string{}
+			for _, a := range d.CurrentActions {
+				actions = append(actions, a.Action+" "+a.App)
+			}
+			fmt.Fprintf(os.Stderr, "Deployment %s: step %d/%d (%s)\n",
+				ref.Id, d.CurrentStep, d.TotalSteps,
+				strings.Join(actions, ", "))
+		}
+
+		select {
+		case <-ctx.Done():
+			reportFailedTasks()
+			return fmt.Errorf("Deployment %s did not finish within %s",
+				ref.Id, deployTimeout)
+		case reason := <-failed:
+			reportFailedTasks()
+			return fmt.Errorf("Deployment %s failed: %s", ref.Id, reason)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// reportFailedTasks prints a summary of unhealthy tasks and the last task
+// failure of the current app to stderr.
+func reportFailedTasks() {
+	app, err := marathonClient().App(context.Background(), id(),
+		"apps.tasks", "apps.lastTaskFailure")
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d/%d running, %d staged, %d healthy, %d unhealthy\n",
+		app.Id, app.TasksRunning, app.Instances, app.TasksStaged,
+		app.TasksHealthy, app.TasksUnhealthy)
+	for _, task := range app.Tasks {
+		for _, hc := range task.HealthCheckResults {
+			if !hc.Alive {
+				fmt.Fprintf(os.Stderr, "  task %s on %s unhealthy (%d consecutive failures): %s\n",
+					task.Id, task.Host, hc.ConsecutiveFailures, hc.LastFailureCause)
+			}
+		}
+		if task.State != "" && task.State != "TASK_RUNNING" {
+			fmt.Fprintf(os.Stderr, "  task %s on %s is %s\n",
+				task.Id, task.Host, task.State)
+		}
+	}
+	if f := app.LastTaskFailure; f != nil {
+		fmt.Fprintf(os.Stderr, "  last failure at %s: task %s on %s %s: %s\n",
+			f.Timestamp, f.TaskId, f.Host, f.State, f.Message)
+	}
+}
+
+// formatEvent renders an event from Marathon's event bus as a single line.
+func formatEvent(e marathon.Event) string {
+	actions := func(step *marathon.Step) string {
+		list := []string{}
+		if step != nil {
+			for _, a := range step.Actions {
+				list = append(list, a.Action+" "+a.App)
+			}
+		}
+		return strings.Join(list, ", ")
+	}
+
+	switch e.Type {
+	case "status_update_event":
+		msg := fmt.Sprintf("task %s on %s: %s", e.TaskId, e.Host, e.TaskStatus)
+		if e.Message != "" {
+			msg += " (" + e.Message + ")"
+		}
+		return msg
+	case "health_status_changed_event":
+		if e.Alive != nil && *e.Alive {
+			return fmt.Sprintf("task %s is healthy", e.TaskId)
+		}
+		return fmt.Sprintf("task %s is unhealthy", e.TaskId)
+	case "failed_health_check_event":
+		return fmt.Sprintf("task %s failed a health check", e.TaskId)
+	case "unhealthy_task_kill_event", "unhealthy_instance_kill_event":
+		return fmt.Sprintf("task %s on %s killed as unhealthy: %s",
+			e.TaskId, e.Host, e.Message)
+	case "deployment_info":
+		return fmt.Sprintf("deployment %s: %s", e.DeploymentId(), actions(e.CurrentStep))
+	case "deployment_step_success":
+		return fmt.Sprintf("deployment %s: step succeeded: %s", e.DeploymentId(), actions(e.CurrentStep))
+	case "deployment_step_failure":
+		return fmt.Sprintf("deployment %s: step failed: %s", e.DeploymentId(), actions(e.CurrentStep))
+	case "deployment_success":
+		return fmt.Sprintf("deployment %s succeeded", e.DeploymentId())
+	case "deployment_failed":
+		return fmt.Sprintf("deployment %s failed", e.DeploymentId())
+	}
+	return e.Type
+}
+
+// followEvents prints the events concerning the current app to stderr
+// until ctx is done. A failure of the given deployment is sent to failed.
+func followEvents(ctx context.Context, events *marathon.EventStream, deploymentId string, failed chan<- string) {
+	err := events.Each(func(e marathon.Event) bool {
+		if !e.Affects(id()) && e.DeploymentId() != deploymentId {
+			return true
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", e.Timestamp, formatEvent(e))
+		if e.Type == "deployment_failed" && e.DeploymentId() == deploymentId {
+			failed <- formatEvent(e)
+			return false
+		}
+		return e.Type != "deployment_success" || e.DeploymentId() != deploymentId
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,266 @@
+// Package marathon is a small client for the parts of Marathon's REST API
+// babl-build needs to deploy and inspect Babl modules.
+package marathon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Client talks to a Marathon cluster. URLs are tried in order until one of
+// the masters can be reached.
+type Client struct {
+	URLs       []string
+	HTTPClient *http.Client
+	Timeout    time.Duration // per request, 0 means no timeout
+
+	User     string
+	Password string
+	Token    string // sent as bearer token, takes precedence over User
+
+	// If set, requests other than GET are printed here, credentials
+	// masked, instead of being sent.
+	DryRun io.Writer
+}
+
+// New returns a client for the given Marathon URLs, e.g.
+// "http://marathon.mesos:8080" or "https://dcos/service/marathon".
+func New(urls ...string) *Client {
+	c := &Client{HTTPClient: &http.Client{}}
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			c.URLs = append(c.URLs, u)
+		}
+	}
+	return c
+}
+
+func (c *Client) authenticate(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
+func (c *Client) printRequest(req *http.Request, payload []byte) {
+	fmt.Fprintln(c.DryRun, req.Method+" "+req.URL.Redacted())
+	names := []string{}
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			if name == "Authorization" {
+				value = strings.SplitN(value, " ", 2)[0] + " xxxxx"
+			}
+			fmt.Fprintf(c.DryRun, "%s: %s\n", name, value)
+		}
+	}
+	if len(payload) > 0 {
+		fmt.Fprintln(c.DryRun, string(payload))
+	}
+}
+
+// Do sends in (if not nil) JSON encoded and decodes the response into out
+// (if not nil). Non-2xx responses are returned as *APIError,
+// *NotFoundError, *ConflictError or *ValidationError. In dry-run mode out
+// is left untouched for all requests but GET.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	resp, err := c.send(ctx, method, path, payload, in != nil)
+	if err != nil || resp == nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeError(method, path, resp.StatusCode, body)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// send tries all masters in order until one of them answers without a
+// server error. The answer of the last master is returned in any case. It
+// returns no response for requests printed in dry-run mode.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, isJSON bool) (*http.Response, error) {
+	if len(c.URLs) == 0 {
+		return nil, fmt.Errorf("No Marathon URL given")
+	}
+
+	var resp *http.Response
+	var err error
+	for i, u := range c.URLs {
+		var req *http.Request
+		req, err = http.NewRequest(method, u+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if isJSON {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if method == "GET" && strings.HasPrefix(path, "/v2/events") {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		c.authenticate(req)
+		if c.DryRun != nil && method != "GET" {
+			c.printRequest(req, payload)
+			return nil, nil
+		}
+		resp, err = c.HTTPClient.Do(req)
+		if ctx.Err() != nil || i == len(c.URLs)-1 {
+			break
+		}
+		if err == nil && resp.StatusCode < 500 {
+			break
+		}
+		if err == nil {
+			resp.Body.Close() // try the next master
+		}
+	}
+	return resp, err
+}
+
+func appPath(id string, force bool, suffix ...string) string {
+	path := "/v2/apps/" + strings.TrimPrefix(id, "/") + strings.Join(suffix, "")
+	if force {
+		path += "?force=true"
+	}
+	return path
+}
+
+// App fetches the state of an app, embedding e.g. "apps.tasks" or
+// "apps.lastTaskFailure".
+func (c *Client) App(ctx context.Context, id string, embed ...string) (*App, error) {
+	query := url.Values{"embed": embed}
+	path := appPath(id, false)
+	if len(embed) > 0 {
+		path += "?" + query.Encode()
+	}
+	var resp struct {
+		App App `json:"app"`
+	}
+	if err := c.Do(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.App, nil
+}
+
+// AppDefinition decodes the current definition of an app into v.
+func (c *Client) AppDefinition(ctx context.Context, id string, v interface{}) error {
+	resp := struct {
+		App interface{} `json:"app"`
+	}{v}
+	return c.Do(ctx, "GET", appPath(id, false), nil, &resp)
+}
+
+// AppVersions lists the version timestamps kept for an app, newest first.
+func (c *Client) AppVersions(ctx context.Context, id string) ([]string, error) {
+	var resp struct {
+		Versions []string `json:"versions"`
+	}
+	err := c.Do(ctx, "GET", appPath(id, false, "/versions"), nil, &resp)
+	return resp.Versions, err
+}
+
+// AppVersion decodes the definition of an app at the given version
+// timestamp into v.
+func (c *Client) AppVersion(ctx context.Context, id, version string, v interface{}) error {
+	return c.Do(ctx, "GET", appPath(id, false, "/versions/", version), nil, v)
+}
+
+// CreateApp creates a new app from the given definition.
+func (c *Client) CreateApp(ctx context.Context, app interface{}) (*App, error) {
+	var created App
+	if err := c.Do(ctx, "POST", "/v2/apps", app, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateApp replaces the definition of an existing app with a rolling
+// update. A body of {"version": timestamp} rolls back to that version.
+func (c *Client) UpdateApp(ctx context.Context, id string, app interface{}, force bool) (DeploymentRef, error) {
+	var ref DeploymentRef
+	err := c.Do(ctx, "PUT", appPath(id, force), app, &ref)
+	return ref, err
+}
+
+// PatchApp changes only the given fields of an app.
+func (c *Client) PatchApp(ctx context.Context, id string, patch interface{}, force bool) (DeploymentRef, error) {
+	var ref DeploymentRef
+	err := c.Do(ctx, "PATCH", appPath(id, force), patch, &ref)
+	return ref, err
+}
+
+// ScaleApp changes the number of instances of an app.
+func (c *Client) ScaleApp(ctx context.Context, id string, instances int, force bool) (DeploymentRef, error) {
+	return c.PatchApp(ctx, id, map[string]int{"instances": instances}, force)
+}
+
+// RestartApp replaces all tasks of an app according to its upgrade
+// strategy.
+func (c *Client) RestartApp(ctx context.Context, id string, force bool) (DeploymentRef, error) {
+	var ref DeploymentRef
+	err := c.Do(ctx, "POST", appPath(id, force, "/restart"), nil, &ref)
+	return ref, err
+}
+
+// DeleteApp destroys an app and all of its tasks.
+func (c *Client) DeleteApp(ctx context.Context, id string, force bool) (DeploymentRef, error) {
+	var ref DeploymentRef
+	err := c.Do(ctx, "DELETE", appPath(id, force), nil, &ref)
+	return ref, err
+}
+
+// Deployments lists all running deployments.
+func (c *Client) Deployments(ctx context.Context) ([]Deployment, error) {
+	var deployments []Deployment
+	err := c.Do(ctx, "GET", "/v2/deployments", nil, &deployments)
+	return deployments, err
+}
+
+// Deployment returns the running deployment with the given id, or nil
+// once it is finished.
+func (c *Client) Deployment(ctx context.Context, id string) (*Deployment, error) {
+	deployments, err := c.Deployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments {
+		if deployments[i].Id == id {
+			return &deployments[i], nil
+		}
+	}
+	return nil, nil
+}
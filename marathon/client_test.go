@@ -0,0 +1,159 @@
+package marathon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestNotFoundError(t *testing.T) {
+	server := testServer(404, `{"message": "App '/missing' does not exist"}`)
+	defer server.Close()
+
+	_, err := New(server.URL).App(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("error mismatch: want NotFoundError; got %#v", err)
+	}
+	if !strings.Contains(err.Error(), "App '/missing' does not exist") {
+		t.Errorf("error mismatch: want Marathon's message; got %s", err)
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	server := testServer(409, `{"message": "App is locked by one or more deployments.", "deployments": [{"id": "97c136bf"}]}`)
+	defer server.Close()
+
+	_, err := New(server.URL).UpdateApp(context.Background(), "x", map[string]int{}, false)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("error mismatch: want ConflictError; got %#v", err)
+	}
+	if len(conflict.Deployments) != 1 || conflict.Deployments[0].Id != "97c136bf" {
+		t.Errorf("deployments mismatch: got %v", conflict.Deployments)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	server := testServer(422, `{"message": "Object is not valid", "details": [{"path": "/cpus", "errors": ["must be greater than or equal to 0"]}]}`)
+	defer server.Close()
+
+	_, err := New(server.URL).CreateApp(context.Background(), map[string]int{})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("error mismatch: want ValidationError; got %#v", err)
+	}
+	if !strings.Contains(err.Error(), "/cpus: must be greater than or equal to 0") {
+		t.Errorf("error mismatch: want details; got %s", err)
+	}
+}
+
+func TestDeploymentRef(t *testing.T) {
+	server := testServer(200, `{"version": "2016-10-05T10:00:00.000Z", "deploymentId": "5ed4c0c5"}`)
+	defer server.Close()
+
+	ref, err := New(server.URL).RestartApp(context.Background(), "x", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Id != "5ed4c0c5" {
+		t.Errorf("deployment mismatch: want 5ed4c0c5; got %s", ref.Id)
+	}
+}
+
+func TestFailoverOnServerError(t *testing.T) {
+	unavailable := testServer(503, `{"message": "Leader not elected"}`)
+	defer unavailable.Close()
+	leader := testServer(200, `{"app": {"id": "/larskluge/string-upcase", "instances": 2}}`)
+	defer leader.Close()
+
+	app, err := New(unavailable.URL, leader.URL).App(context.Background(), "larskluge/string-upcase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Instances != 2 {
+		t.Errorf("app mismatch: want 2 instances; got %d", app.Instances)
+	}
+
+	_, err = New(unavailable.URL).App(context.Background(), "larskluge/string-upcase")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != 503 {
+		t.Errorf("error mismatch: want 503 of the last master; got %#v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Timeout = 10 * time.Millisecond
+	if _, err := c.Deployments(context.Background()); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := testServer(200, "event: event_stream_attached\n"+
+		"data: {\"eventType\":\"event_stream_attached\"}\n\n"+
+		"event: status_update_event\n"+
+		"data: {\"eventType\":\"status_update_event\",\"appId\":\"/larskluge/string-upcase\",\"taskStatus\":\"TASK_RUNNING\"}\n\n"+
+		"event: deployment_success\n"+
+		"data: {\"eventType\":\"deployment_success\",\"id\":\"5ed4c0c5\",\"plan\":{\"id\":\"5ed4c0c5\",\"steps\":[{\"actions\":[{\"action\":\"RestartApplication\",\"app\":\"/larskluge/string-upcase\"}]}]}}\n\n")
+	defer server.Close()
+
+	events := []Event{}
+	err := New(server.URL).Events(context.Background(), func(e Event) bool {
+		if e.Affects("larskluge/string-upcase") {
+			events = append(events, e)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events mismatch: want 2; got %v", events)
+	}
+	if events[0].TaskStatus != "TASK_RUNNING" {
+		t.Errorf("event mismatch: want TASK_RUNNING; got %v", events[0])
+	}
+	if events[1].DeploymentId() != "5ed4c0c5" {
+		t.Errorf("event mismatch: want deployment 5ed4c0c5; got %v", events[1])
+	}
+}
+
+func TestEventsStopWhenHandled(t *testing.T) {
+	server := testServer(200, ": keep-alive\n\n"+
+		"event: deployment_info\n"+
+		"data: {\"eventType\":\"deployment_info\",\n"+
+		"data: \"plan\":{\"id\":\"5ed4c0c5\"}}\n\n"+
+		"data: not json\n\n"+
+		"event: deployment_success\n"+
+		"data: {\"eventType\":\"deployment_success\",\"id\":\"5ed4c0c5\"}\n\n"+
+		"event: deployment_success\n"+
+		"data: {\"eventType\":\"deployment_success\",\"id\":\"9a0e0ec1\"}\n\n")
+	defer server.Close()
+
+	types := []string{}
+	err := New(server.URL).Events(context.Background(), func(e Event) bool {
+		types = append(types, e.Type+" "+e.DeploymentId())
+		return e.Type != "deployment_success"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "deployment_info 5ed4c0c5, deployment_success 5ed4c0c5"
+	if actual := strings.Join(types, ", "); expected != actual {
+		t.Errorf("events mismatch: want %s; got %s", expected, actual)
+	}
+}
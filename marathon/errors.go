@@ -0,0 +1,73 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is a non-2xx response from Marathon, with the message and
+// details Marathon sent along decoded.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Method     string `json:"-"`
+	Path       string `json:"-"`
+	Message    string `json:"message"`
+	Details    []struct {
+		Path   string   `json:"path"`
+		Errors []string `json:"errors"`
+	} `json:"details"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("Marathon %s %s: %d %s", e.Method, e.Path,
+		e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	for _, d := range e.Details {
+		msg += fmt.Sprintf("\n  %s: %s", d.Path, strings.Join(d.Errors, ", "))
+	}
+	return msg
+}
+
+// NotFoundError is returned for 404 responses, e.g. for unknown apps.
+type NotFoundError struct{ *APIError }
+
+// ConflictError is returned for 409 responses, usually because the app is
+// locked by running deployments.
+type ConflictError struct {
+	*APIError
+	Deployments []DeploymentRef
+}
+
+// ValidationError is returned for 422 responses, when Marathon rejects an
+// app definition.
+type ValidationError struct{ *APIError }
+
+// IsNotFound tells whether err is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+func decodeError(method, path string, status int, body []byte) error {
+	e := &APIError{StatusCode: status, Method: method, Path: path}
+	var conflict struct {
+		Deployments []DeploymentRef `json:"deployments"`
+	}
+	if json.Unmarshal(body, e) != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	switch status {
+	case http.StatusNotFound:
+		return &NotFoundError{e}
+	case http.StatusConflict:
+		_ = json.Unmarshal(body, &conflict) // ignore error
+		return &ConflictError{e, conflict.Deployments}
+	case 422:
+		return &ValidationError{e}
+	}
+	return e
+}
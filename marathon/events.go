@@ -0,0 +1,149 @@
+package marathon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Event is a message from Marathon's event bus. Only the fields needed to
+// follow deployments of single apps are decoded.
+type Event struct {
+	Type        string `json:"eventType"`
+	Timestamp   string `json:"timestamp"`
+	AppId       string `json:"appId"`
+	TaskId      string `json:"taskId"`
+	Host        string `json:"host"`
+	TaskStatus  string `json:"taskStatus"`
+	Message     string `json:"message"`
+	Alive       *bool  `json:"alive"`
+	Id          string `json:"id"`
+	Plan        *Plan  `json:"plan"`
+	CurrentStep *Step  `json:"currentStep"`
+	Step        *Step  `json:"step"`
+}
+
+// Plan is the list of steps of a deployment.
+type Plan struct {
+	Id    string  `json:"id"`
+	Steps []*Step `json:"steps"`
+}
+
+// Step is a set of actions Marathon executes in parallel.
+type Step struct {
+	Actions []struct {
+		Action string `json:"action"`
+		App    string `json:"app"`
+	} `json:"actions"`
+}
+
+// DeploymentId returns the deployment an event belongs to, if any.
+func (e Event) DeploymentId() string {
+	if e.Plan != nil {
+		return e.Plan.Id
+	}
+	if strings.HasPrefix(e.Type, "deployment_") {
+		return e.Id
+	}
+	return ""
+}
+
+// Affects tells whether an event concerns the app with the given id.
+func (e Event) Affects(appId string) bool {
+	appId = "/" + strings.TrimPrefix(appId, "/")
+	if e.AppId == appId {
+		return true
+	}
+	steps := []*Step{e.CurrentStep, e.Step}
+	if e.Plan != nil {
+		steps = append(steps, e.Plan.Steps...)
+	}
+	for _, step := range steps {
+		if step == nil {
+			continue
+		}
+		for _, action := range step.Actions {
+			if action.App == appId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EventStream is a subscription to Marathon's event bus.
+type EventStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	body   io.ReadCloser
+}
+
+// Subscribe connects to Marathon's server-sent event stream. Events are
+// kept by the connection until read with Each, so subscribing before
+// changing an app catches all events of the change. Request timeouts do
+// not apply to the stream.
+func (c *Client) Subscribe(ctx context.Context) (*EventStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := c.send(ctx, "GET", "/v2/events", nil, false)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body) // ignore error
+		resp.Body.Close()
+		cancel()
+		return nil, decodeError("GET", "/v2/events", resp.StatusCode, body)
+	}
+	return &EventStream{ctx, cancel, resp.Body}, nil
+}
+
+// Close ends the subscription.
+func (s *EventStream) Close() {
+	s.cancel()
+	s.body.Close()
+}
+
+// Each calls handle for each event until handle returns false, the stream
+// ends or the subscription is closed.
+func (s *EventStream) Each(handle func(Event) bool) error {
+	scanner := bufio.NewScanner(s.body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	data := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "" && len(data) > 0:
+			var e Event
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e)
+			data = data[:0]
+			if err != nil {
+				continue // skip events we cannot decode
+			}
+			if !handle(e) {
+				return nil
+			}
+		}
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// Events subscribes to Marathon's server-sent event stream and calls
+// handle for each event until handle returns false, the stream ends or
+// ctx is cancelled.
+func (c *Client) Events(ctx context.Context, handle func(Event) bool) error {
+	s, err := c.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Each(handle)
+}
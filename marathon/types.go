@@ -0,0 +1,85 @@
+package marathon
+
+import "encoding/json"
+
+// App is the state of an app as reported by Marathon.
+type App struct {
+	Id             string            `json:"id"`
+	Version        string            `json:"version"`
+	Instances      int               `json:"instances"`
+	TasksRunning   int               `json:"tasksRunning"`
+	TasksStaged    int               `json:"tasksStaged"`
+	TasksHealthy   int               `json:"tasksHealthy"`
+	TasksUnhealthy int               `json:"tasksUnhealthy"`
+	Labels         map[string]string `json:"labels"`
+	Container      struct {
+		Docker struct {
+			Image string `json:"image"`
+		} `json:"docker"`
+	} `json:"container"`
+	Tasks           []Task           `json:"tasks"`
+	Deployments     []DeploymentRef  `json:"deployments"`
+	LastTaskFailure *LastTaskFailure `json:"lastTaskFailure"`
+}
+
+// Task is a running or staged instance of an app.
+type Task struct {
+	Id                 string              `json:"id"`
+	Host               string              `json:"host"`
+	Ports              []int               `json:"ports"`
+	State              string              `json:"state"`
+	StagedAt           string              `json:"stagedAt"`
+	StartedAt          string              `json:"startedAt"`
+	Version            string              `json:"version"`
+	HealthCheckResults []HealthCheckResult `json:"healthCheckResults"`
+}
+
+type HealthCheckResult struct {
+	Alive               bool   `json:"alive"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastFailureCause    string `json:"lastFailureCause"`
+}
+
+type LastTaskFailure struct {
+	TaskId    string `json:"taskId"`
+	Host      string `json:"host"`
+	State     string `json:"state"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Deployment is a deployment Marathon is currently executing.
+type Deployment struct {
+	Id             string   `json:"id"`
+	AffectedApps   []string `json:"affectedApps"`
+	CurrentStep    int      `json:"currentStep"`
+	TotalSteps     int      `json:"totalSteps"`
+	CurrentActions []struct {
+		Action string `json:"action"`
+		App    string `json:"app"`
+	} `json:"currentActions"`
+}
+
+// DeploymentRef references the deployment started by a change to an app.
+type DeploymentRef struct {
+	Id      string `json:"deploymentId"`
+	Version string `json:"version"`
+}
+
+// UnmarshalJSON accepts both the {"id": ...} form embedded in apps and
+// the {"deploymentId": ...} form returned for app changes.
+func (d *DeploymentRef) UnmarshalJSON(data []byte) error {
+	var ref struct {
+		Id           string `json:"id"`
+		DeploymentId string `json:"deploymentId"`
+		Version      string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return err
+	}
+	d.Id, d.Version = ref.DeploymentId, ref.Version
+	if d.Id == "" {
+		d.Id = ref.Id
+	}
+	return nil
+}
@@ -5,11 +5,33 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"time"
 )
 
 var (
-	dryRun       bool
-	marathonHost string
+	dryRun            bool
+	marathonHost      string
+	marathonUrl       string
+	marathonCa        string
+	marathonCert      string
+	marathonKey       string
+	marathonUser      string
+	marathonPassword  string
+	marathonToken     string
+	marathonTokenFile string
+	marathonTimeout   time.Duration
+	deployTimeout     time.Duration
+	force             bool
+	hard              bool
+	jsonOutput        bool
+	noWait            bool
+	follow            bool
+	secretsFile       string
+	profile           string
+	explainConfig     bool
+	sets              setFlags
+	configFile        string
+	moduleDir         string
 )
 
 func help(args ...string) {
@@ -49,6 +71,27 @@ func help(args ...string) {
 func init() {
 	flag.BoolVar(&dryRun, "dry-run", false, "")
 	flag.StringVar(&marathonHost, "marathon-host", "127.0.0.1", "")
+	flag.StringVar(&marathonUrl, "marathon-url", "", "")
+	flag.StringVar(&marathonCa, "marathon-ca", "", "")
+	flag.StringVar(&marathonCert, "marathon-cert", "", "")
+	flag.StringVar(&marathonKey, "marathon-key", "", "")
+	flag.StringVar(&marathonUser, "marathon-user", "", "")
+	flag.StringVar(&marathonPassword, "marathon-password", "", "")
+	flag.StringVar(&marathonToken, "marathon-token", "", "")
+	flag.StringVar(&marathonTokenFile, "marathon-token-file", "", "")
+	flag.DurationVar(&marathonTimeout, "marathon-timeout", 30*time.Second, "")
+	flag.DurationVar(&deployTimeout, "deploy-timeout", 5*time.Minute, "")
+	flag.BoolVar(&force, "force", false, "")
+	flag.BoolVar(&hard, "hard", false, "")
+	flag.BoolVar(&jsonOutput, "json", false, "")
+	flag.BoolVar(&noWait, "no-wait", false, "")
+	flag.BoolVar(&follow, "follow", false, "")
+	flag.StringVar(&configFile, "file", "", "")
+	flag.StringVar(&moduleDir, "dir", "", "")
+	flag.StringVar(&profile, "env", "", "")
+	flag.Var(&sets, "set", "")
+	flag.BoolVar(&explainConfig, "explain", false, "")
+	flag.StringVar(&secretsFile, "secrets-file", "babl.secrets.yml", "")
 	flag.Usage = func() {
 		help()
 	}
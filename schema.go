@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// descriptions of all babl.yml settings by path. Elements of lists share
+// the path of the list, values of maps are named "*".
+var descriptions = map[string]string{
+	"id":                                 "Marathon app id and Docker image name of the module, e.g. larskluge/string-upcase",
+	"registry":                           "Docker registry the module image is pushed to and pulled from",
+	"container":                          "Container the module runs in",
+	"container.type":                     "Containerizer, always DOCKER",
+	"container.docker":                   "Docker settings",
+	"container.docker.image":             "Docker image, set by babl-build from registry, id and git version",
+	"container.docker.forcePullImage":    "Pull the image even if it is already present on the agent",
+	"container.docker.network":           "Docker network mode",
+	"container.docker.portMappings":      "Ports to map from the container to the agent, ignored with HOST network",
+	"container.docker.portMappings.name": "Name of the port, referenced by readiness checks",
+	"container.docker.portMappings.containerPort": "Port inside the container",
+	"container.docker.portMappings.hostPort":      "Port on the agent, 0 for a random one",
+	"container.docker.portMappings.servicePort":   "Port for service discovery, 0 for a random one",
+	"container.docker.portMappings.protocol":      "Protocol of the port",
+	"container.docker.parameters":                 "Extra docker run parameters, e.g. log drivers",
+	"container.docker.parameters.key":             "Name of the docker run option, without leading dashes",
+	"container.docker.parameters.value":           "Value of the docker run option",
+	"container.options":                           "Extra docker run options for play and sh, not deployed",
+	"container.volumes":                           "Host paths to mount into the container",
+	"container.volumes.hostPath":                  "Absolute path on the agent",
+	"container.volumes.containerPath":             "Absolute path inside the container",
+	"container.volumes.mode":                      "Mount read-only or read-write",
+	"instances":                                   "Number of instances to run",
+	"cpus":                                        "CPU shares per instance",
+	"mem":                                         "Memory per instance in MiB, 0 for unlimited",
+	"disk":                                        "Disk space per instance in MiB",
+	"uris":                                        "URIs the Mesos fetcher downloads into the sandbox",
+	"env":                                         "Environment variables of the module",
+	"env.*":                                       "Value of the environment variable, ${VAR} references are expanded",
+	"secrets":                                     "Secret environment variables by name, only deployed with a source",
+	"secrets.*":                                   "Where the value of the secret comes from",
+	"secrets.*.env":                               "Local environment variable holding the secret, for local runs",
+	"secrets.*.file":                              "Local file holding the secret, for local runs",
+	"secrets.*.encrypted":                         "Name of the secret in the encrypted secrets file, for local runs",
+	"secrets.*.source":                            "Source of the secret in Marathon's secret store, needed to deploy it",
+	"profiles":                                    "Named settings like staging or production, selected with --env and merged on top",
+	"profiles.*":                                  "Settings of the profile",
+	"cmd":                                         "Command to run in the container",
+	"constraints":                                 "Placement constraints, e.g. [hostname, UNIQUE]",
+	"constraints.*":                               "Field, operator and optional value of the constraint",
+	"labels":                                      "Labels of the Marathon app",
+	"labels.*":                                    "Value of the label",
+	"acceptedResourceRoles":                       "Mesos roles whose resources the app may use, e.g. slave_public",
+	"healthChecks":                                "Health checks, an empty list disables the default TCP check",
+	"healthChecks.protocol":                       "Protocol of the health check",
+	"healthChecks.path":                           "Path requested by HTTP health checks",
+	"healthChecks.portIndex":                      "Index of the port mapping to check",
+	"healthChecks.command":                        "Command to run for COMMAND health checks",
+	"healthChecks.command.value":                  "Shell command, healthy if it exits with 0",
+	"healthChecks.gracePeriodSeconds":             "Seconds to ignore failures after a task started",
+	"healthChecks.intervalSeconds":                "Seconds between checks",
+	"healthChecks.timeoutSeconds":                 "Seconds after which a check fails",
+	"healthChecks.maxConsecutiveFailures":         "Failures after which a task is killed, 0 to never kill",
+	"upgradeStrategy":                             "How tasks are replaced during deployments",
+	"upgradeStrategy.minimumHealthCapacity":       "Share of instances which stay healthy during an upgrade",
+	"upgradeStrategy.maximumOverCapacity":         "Share of instances which may be started on top during an upgrade",
+	"backoffSeconds":                              "Initial delay before restarting failed tasks",
+	"backoffFactor":                               "Factor the restart delay grows with on each failure",
+	"maxLaunchDelaySeconds":                       "Maximum delay before restarting failed tasks",
+	"readinessChecks":                             "Checks which need to pass before a new task counts as ready",
+	"readinessChecks.name":                        "Name of the readiness check",
+	"readinessChecks.protocol":                    "Protocol of the readiness check",
+	"readinessChecks.path":                        "Path requested by the readiness check",
+	"readinessChecks.portName":                    "Name of the port mapping to check",
+	"readinessChecks.intervalSeconds":             "Seconds between checks",
+	"readinessChecks.timeoutSeconds":              "Seconds after which a check fails",
+	"readinessChecks.httpStatusCodesForReady":     "HTTP status codes meaning ready",
+	"marathon":                                    "Marathon cluster to deploy to",
+	"marathon.url":                                "Comma separated Marathon URLs, tried in order",
+	"marathon.caBundle":                           "CA certificates to trust for HTTPS connections to Marathon",
+}
+
+// enums of settings with a fixed set of values, by path.
+var enums = map[string][]string{
+	"container.type":                         {"DOCKER"},
+	"container.docker.network":               {"BRIDGE", "HOST", "USER"},
+	"container.docker.portMappings.protocol": {"tcp", "udp", "udp,tcp"},
+	"container.volumes.mode":                 {"RO", "RW"},
+	"healthChecks.protocol":                  {"HTTP", "HTTPS", "TCP", "COMMAND", "MESOS_HTTP", "MESOS_HTTPS", "MESOS_TCP"},
+	"readinessChecks.protocol":               {"HTTP", "HTTPS"},
+}
+
+// schema returns a JSON Schema of babl.yml, with the defaults taken from
+// the embedded build-config.yml.
+func schema() map[string]interface{} {
+	contents, err := Asset("build-config.yml")
+	check(err)
+	var defaults interface{}
+	check(yaml.Unmarshal(contents, &defaults))
+
+	s := schemaFor(reflect.TypeOf(config{}), "", plain(defaults))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "babl.yml"
+	s["description"] = "Build and deployment settings of a Babl module"
+	return s
+}
+
+func schemaFor(t reflect.Type, path string, defaults interface{}) map[string]interface{} {
+	s := map[string]interface{}{}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), path, defaults)
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			var value interface{}
+			if m, ok := defaults.(map[string]interface{}); ok {
+				value = m[name]
+			}
+			properties[name] = schemaFor(t.Field(i).Type, join(path, name), value)
+		}
+		s["type"] = "object"
+		s["properties"] = properties
+		s["additionalProperties"] = false
+	case reflect.Map:
+		s["type"] = "object"
+		if t.Elem() == reflect.TypeOf(config{}) {
+			s["additionalProperties"] = map[string]interface{}{
+				"$ref":        "#",
+				"description": descriptions[join(path, "*")],
+			}
+		} else {
+			s["additionalProperties"] = schemaFor(t.Elem(), join(path, "*"), nil)
+		}
+	case reflect.Slice:
+		s["type"] = "array"
+		items := path
+		if t.Elem().Kind() == reflect.Slice {
+			items = join(path, "*")
+		}
+		item := schemaFor(t.Elem(), items, nil)
+		if items == path {
+			delete(item, "description")
+		}
+		s["items"] = item
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Int:
+		s["type"] = "integer"
+	case reflect.Float64:
+		s["type"] = "number"
+	}
+
+	if d, ok := descriptions[path]; ok {
+		s["description"] = d
+	}
+	if e, ok := enums[path]; ok {
+		s["enum"] = e
+	}
+	if defaults != nil && t.Kind() != reflect.Struct {
+		s["default"] = defaults
+	}
+	return s
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// plain turns values decoded from YAML into ones encoding/json can handle,
+// leaving out the "..." placeholders babl-build fills in.
+func plain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			if value != "..." {
+				m[key.(string)] = plain(value)
+			}
+		}
+		return m
+	case []interface{}:
+		list := []interface{}{}
+		for _, value := range v {
+			list = append(list, plain(value))
+		}
+		return list
+	}
+	return v
+}
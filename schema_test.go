@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func property(s map[string]interface{}, names ...string) map[string]interface{} {
+	for _, name := range names {
+		if name == "[]" {
+			s = s["items"].(map[string]interface{})
+		} else {
+			s = s["properties"].(map[string]interface{})[name].(map[string]interface{})
+		}
+	}
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	blob, err := json.Marshal(schema())
+	check(err)
+	var s map[string]interface{}
+	check(json.Unmarshal(blob, &s))
+
+	network := property(s, "container", "docker", "network")
+	if !reflect.DeepEqual(network["enum"], []interface{}{"BRIDGE", "HOST", "USER"}) {
+		t.Errorf("schema mismatch: want network enum; got %v", network["enum"])
+	}
+	if network["default"] != "BRIDGE" {
+		t.Errorf("schema mismatch: want default BRIDGE; got %v", network["default"])
+	}
+	mem := property(s, "mem")
+	if mem["type"] != "number" || mem["default"] != 16.0 {
+		t.Errorf("schema mismatch: want number defaulting to 16; got %v", mem)
+	}
+	mode := property(s, "container", "volumes", "[]", "mode")
+	if !reflect.DeepEqual(mode["enum"], []interface{}{"RO", "RW"}) {
+		t.Errorf("schema mismatch: want mode enum; got %v", mode["enum"])
+	}
+	id := property(s, "id")
+	if _, ok := id["default"]; ok {
+		t.Errorf("schema mismatch: want no default for id; got %v", id["default"])
+	}
+	if s["additionalProperties"] != false {
+		t.Errorf("schema mismatch: want unknown keys rejected")
+	}
+}
+
+func TestSchemaDescribesAllSettings(t *testing.T) {
+	var walk func(path string, s map[string]interface{})
+	walk = func(path string, s map[string]interface{}) {
+		if path != "" && s["description"] == nil && s["$ref"] == nil {
+			t.Errorf("schema mismatch: want a description for %s", path)
+		}
+		if properties, ok := s["properties"].(map[string]interface{}); ok {
+			for name, p := range properties {
+				walk(join(path, name), p.(map[string]interface{}))
+			}
+		}
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			if properties, ok := items["properties"].(map[string]interface{}); ok {
+				for name, p := range properties {
+					walk(path+"[]."+name, p.(map[string]interface{}))
+				}
+			}
+		}
+		if values, ok := s["additionalProperties"].(map[string]interface{}); ok {
+			walk(path+".*", values)
+		}
+	}
+	walk("", schema())
+}
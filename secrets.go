@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const masked = "xxxxx"
+
+// secret tells where the value of a secret env variable comes from: the
+// local environment, a file on disk or the encrypted secrets file. With a
+// source the deployed app references Marathon's secret store instead.
+type secret struct {
+	Env       string `yaml:"env"`
+	File      string `yaml:"file"`
+	Encrypted string `yaml:"encrypted"`
+	Source    string `yaml:"source"`
+}
+
+// envVars are env variables as found in babl.yml and Marathon apps, where
+// references to Marathon secrets are kept as "<secret NAME>".
+type envVars map[string]string
+
+func secretRef(name string) string {
+	return "<secret " + name + ">"
+}
+
+func (e *envVars) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = envVars{}
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			(*e)[key] = s
+			continue
+		}
+		var ref struct {
+			Secret string `json:"secret"`
+		}
+		if err := json.Unmarshal(value, &ref); err != nil {
+			return fmt.Errorf("env %s: %s", key, err)
+		}
+		(*e)[key] = secretRef(ref.Secret)
+	}
+	return nil
+}
+
+func (s secret) resolve(name string) (string, error) {
+	switch {
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("Secret %s: environment variable %s is not set", name, s.Env)
+		}
+		return value, nil
+	case s.File != "":
+		contents, err := ioutil.ReadFile(expandHome(s.File))
+		if err != nil {
+			return "", fmt.Errorf("Secret %s: %s", name, err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	case s.Encrypted != "":
+		secrets, err := readSecretsFile()
+		if err != nil {
+			return "", err
+		}
+		value, ok := secrets[s.Encrypted]
+		if !ok {
+			return "", fmt.Errorf("Secret %s: %s not found in %s", name, s.Encrypted, secretsPath())
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("Secret %s has no local value (env, file or encrypted)", name)
+}
+
+// secretsKey returns the AES-256 key for the secrets file, given base64
+// encoded in $BABL_SECRETS_KEY.
+func secretsKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("BABL_SECRETS_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("BABL_SECRETS_KEY must hold a base64 encoded 32 byte key, e.g. from `head -c32 /dev/urandom | base64`")
+	}
+	return key, nil
+}
+
+func secretsCipher() (cipher.AEAD, error) {
+	key, err := secretsKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretsPath is the --secrets-file, relative to the module directory.
+func secretsPath() string {
+	if filepath.IsAbs(secretsFile) {
+		return secretsFile
+	}
+	return filepath.Join(moduleDirectory(), secretsFile)
+}
+
+// readSecretsFile decrypts all values of the secrets file. The file is a
+// YAML map from secret names to the base64 encoded 12 byte nonce followed
+// by the AES-256-GCM ciphertext of the value, sealed with the name as
+// additional data and the key from $BABL_SECRETS_KEY. The secret command
+// writes it.
+func readSecretsFile() (map[string]string, error) {
+	path := secretsPath()
+	secrets := map[string]string{}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(contents, &secrets); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	gcm, err := secretsCipher()
+	if err != nil {
+		return nil, err
+	}
+	for name, encoded := range secrets {
+		blob, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(blob) < gcm.NonceSize() {
+			return nil, fmt.Errorf("%s: %s is not encrypted", path, name)
+		}
+		nonce, ciphertext := blob[:gcm.NonceSize()], blob[gcm.NonceSize():]
+		plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot decrypt %s, wrong BABL_SECRETS_KEY?", path, name)
+		}
+		secrets[name] = string(plaintext)
+	}
+	return secrets, nil
+}
+
+// writeSecret encrypts value and stores it under name in the secrets file,
+// creating the file if needed.
+func writeSecret(name, value string) error {
+	path := secretsPath()
+	secrets := map[string]string{}
+	if contents, err := ioutil.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(contents, &secrets); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	gcm, err := secretsCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	secrets[name] = base64.StdEncoding.EncodeToString(
+		gcm.Seal(nonce, nonce, []byte(value), []byte(name)))
+
+	contents, err := yaml.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0600)
+}
+
+func secretNames(c config) []string {
+	names := []string{}
+	for name := range c.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// localSecrets resolves the secrets of c as plain env variables for local
+// runs, masked unless reveal is set. Secrets only available in Marathon's
+// secret store are left out.
+func localSecrets(c config, reveal bool) (map[string]string, error) {
+	env := map[string]string{}
+	for _, name := range secretNames(c) {
+		s := c.Secrets[name]
+		if s.Env == "" && s.File == "" && s.Encrypted == "" {
+			continue
+		}
+		if !reveal {
+			env[name] = masked
+			continue
+		}
+		value, err := s.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// deployableSecrets rejects secrets without a source in Marathon's secret
+// store. Values from the local environment, files or the secrets file are
+// only passed to local runs, never deployed, as Marathon would keep them in
+// plain text in the app's definition and all of its stored versions.
+func deployableSecrets(c config) error {
+	local := []string{}
+	for _, name := range secretNames(c) {
+		if c.Secrets[name].Source == "" {
+			local = append(local, name)
+		}
+	}
+	if len(local) > 0 {
+		return fmt.Errorf("Secrets without a source in Marathon's secret store cannot be deployed: %s\n"+
+			"Store them in Marathon and set secrets.NAME.source; env, file and encrypted secrets are only passed to play, sh and run-in-production",
+			strings.Join(local, ", "))
+	}
+	return nil
+}
+
+// marathonDefinition returns the app definition sent to Marathon. Secrets
+// with a source are referenced from env and listed in the top-level
+// secrets, so their values never show up in the app's env or its stored
+// versions. Secrets only available locally are left out, see
+// deployableSecrets.
+func marathonDefinition(c config) (map[string]interface{}, error) {
+	var def map[string]interface{}
+	blob, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &def); err != nil {
+		return nil, err
+	}
+	secrets := map[string]interface{}{}
+	for _, name := range secretNames(c) {
+		if source := c.Secrets[name].Source; source != "" {
+			secrets[name] = map[string]string{"source": source}
+		}
+	}
+	if len(secrets) == 0 {
+		return def, nil
+	}
+
+	env, ok := def["env"].(map[string]interface{})
+	if !ok {
+		env = map[string]interface{}{}
+		def["env"] = env
+	}
+	for name := range secrets {
+		env[name] = map[string]string{"secret": name}
+	}
+	def["secrets"] = secrets
+	return def, nil
+}
+
+// localDefinition is the local config the way it is deployed.
+func localDefinition() (config, error) {
+	var c config
+	def, err := marathonDefinition(conf())
+	if err != nil {
+		return c, err
+	}
+	blob, err := json.Marshal(def)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(blob, &c)
+	return c, err
+}
+
+// maskSecrets hides the values of secrets an older deploy put into the
+// env of a config fetched from Marathon as plain text.
+func maskSecrets(remote *config, local config) {
+	for name := range local.Secrets {
+		if value, ok := remote.Env[name]; ok && value != secretRef(name) {
+			remote.Env[name] = masked
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretsMaskedInConfig(t *testing.T) {
+	os.Setenv("TEST_BABL_API_KEY", "s3cr3t")
+	defer os.Unsetenv("TEST_BABL_API_KEY")
+
+	content := execConfig("secrets")
+	output := content.String()
+	if strings.Contains(output, "s3cr3t") {
+		t.Errorf("config leaked secret: %s", output)
+	}
+	c := execConfigParsed("secrets")
+	if value, ok := c.Env["API_KEY"]; ok {
+		t.Errorf("config mismatch: want local secret left out; got %s", value)
+	}
+	expected := secretRef("DB_PASSWORD")
+	actual := c.Env["DB_PASSWORD"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestSecretsReferencedForDeploy(t *testing.T) {
+	os.Setenv("TEST_BABL_API_KEY", "s3cr3t")
+	defer os.Unsetenv("TEST_BABL_API_KEY")
+
+	setupFor("secrets")
+	def, err := marathonDefinition(conf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := json.Marshal(def)
+	check(err)
+	if bytes.Contains(blob, []byte("s3cr3t")) {
+		t.Errorf("definition leaked secret: %s", blob)
+	}
+	env := def["env"].(map[string]interface{})
+	secrets := def["secrets"].(map[string]interface{})
+	ref, ok := env["DB_PASSWORD"].(map[string]string)
+	if !ok || ref["secret"] != "DB_PASSWORD" {
+		t.Errorf("env mismatch: want a reference to secret DB_PASSWORD; got %v", env["DB_PASSWORD"])
+	}
+	if source := secrets["DB_PASSWORD"].(map[string]string)["source"]; source != "babl/db-password" {
+		t.Errorf("secrets mismatch: want babl/db-password; got %s", source)
+	}
+	if _, ok := secrets["API_KEY"]; ok {
+		t.Errorf("secrets mismatch: want local secret left out; got %v", secrets)
+	}
+}
+
+func TestLocalSecretsNotDeployable(t *testing.T) {
+	setupFor("secrets")
+	err := deployableSecrets(conf())
+	if err == nil || !strings.Contains(err.Error(), "cannot be deployed: API_KEY\n") {
+		t.Errorf("error mismatch: want API_KEY rejected; got %v", err)
+	}
+	setupFor("string-upcase")
+	if err := deployableSecrets(conf()); err != nil {
+		t.Errorf("error mismatch: want no error without secrets; got %v", err)
+	}
+}
+
+func TestSecretsNotInDockerArgs(t *testing.T) {
+	os.Setenv("TEST_BABL_API_KEY", "s3cr3t")
+	defer os.Unsetenv("TEST_BABL_API_KEY")
+
+	setupFor("secrets")
+	args, env := dockerEnv(false)
+	if actual := strings.Join(args, " "); !strings.HasPrefix(actual, "-e API_KEY -e ") {
+		t.Errorf("args mismatch: want API_KEY by name only; got %s", actual)
+	}
+	if expected := []string{"API_KEY=s3cr3t"}; !reflect.DeepEqual(expected, env) {
+		t.Errorf("env mismatch: want %v; got %v", expected, env)
+	}
+
+	dryRun = true
+	defer func() { dryRun = false }()
+	if _, env := dockerEnv(false); strings.Contains(strings.Join(env, " "), "s3cr3t") {
+		t.Errorf("dry run resolved secret: %v", env)
+	}
+}
+
+func TestEncryptedSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "babl-secrets")
+	check(err)
+	defer os.RemoveAll(dir)
+	secretsFile = filepath.Join(dir, "babl.secrets.yml")
+	defer func() { secretsFile = "babl.secrets.yml" }()
+	os.Setenv("BABL_SECRETS_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	defer os.Unsetenv("BABL_SECRETS_KEY")
+
+	check(writeSecret("api-key", "s3cr3t"))
+	contents, err := ioutil.ReadFile(secretsFile)
+	check(err)
+	if bytes.Contains(contents, []byte("s3cr3t")) {
+		t.Errorf("secrets file holds plaintext: %s", contents)
+	}
+	value, err := secret{Encrypted: "api-key"}.resolve("API_KEY")
+	if err != nil || value != "s3cr3t" {
+		t.Errorf("secret mismatch: want s3cr3t; got %q, %v", value, err)
+	}
+}
+
+func TestSecretsMaskedInDiff(t *testing.T) {
+	setupFor("secrets")
+	remote := config{Env: envVars{
+		"API_KEY":     "s3cr3t",
+		"DB_PASSWORD": secretRef("DB_PASSWORD"),
+	}}
+	maskSecrets(&remote, conf())
+	if remote.Env["API_KEY"] != masked || remote.Env["DB_PASSWORD"] != secretRef("DB_PASSWORD") {
+		t.Errorf("env mismatch: want plain secret masked; got %v", remote.Env)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// setFlags are the repeatable --set path=value overrides, e.g.
+// "cpus=0.5", "env.FOO=bar" or "healthChecks[0].path=/health".
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *setFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%q is not of the form path=value", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+var segmentPattern = regexp.MustCompile(`^([^\[\]]+)((?:\[[0-9]+\])*)$`)
+
+// applySets applies all --set overrides to c, checking each value against
+// the type of the field it is set on.
+func applySets(c *config, sets setFlags) error {
+	for _, set := range sets {
+		parts := strings.SplitN(set, "=", 2)
+		if err := setPath(reflect.ValueOf(c).Elem(), parts[0], parts[1]); err != nil {
+			return fmt.Errorf("--set %s: %s", set, err)
+		}
+	}
+	return nil
+}
+
+// setPath sets the field at the dotted path below v, named as in babl.yml.
+func setPath(v reflect.Value, path, value string) error {
+	if path == "" {
+		return setValue(v, value)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), path, value)
+	case reflect.Map:
+		// Keys of plain maps like env may contain dots themselves
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return setMapEntry(v, path, "", value)
+		}
+		key, rest := splitPath(path)
+		return setMapEntry(v, key, rest, value)
+	case reflect.Struct:
+	default:
+		return fmt.Errorf("%s has no fields", v.Type())
+	}
+
+	segment, rest := splitPath(path)
+	m := segmentPattern.FindStringSubmatch(segment)
+	if m == nil {
+		return fmt.Errorf("invalid path segment %q", segment)
+	}
+	field, ok := fieldByName(v, m[1])
+	if !ok {
+		return fmt.Errorf("unknown field %s", m[1])
+	}
+	for _, index := range strings.Split(strings.Trim(m[2], "[]"), "][") {
+		if index == "" {
+			continue
+		}
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("%s is not a list", m[1])
+		}
+		i, _ := strconv.Atoi(index)
+		if i > field.Len() {
+			return fmt.Errorf("index %d out of range, %s has %d elements", i, m[1], field.Len())
+		}
+		if i == field.Len() {
+			field.Set(reflect.Append(field, reflect.Zero(field.Type().Elem())))
+		}
+		field = field.Index(i)
+	}
+	return setPath(field, rest, value)
+}
+
+// splitPath splits the first segment off a dotted path.
+func splitPath(path string) (string, string) {
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func setMapEntry(m reflect.Value, key, path, value string) error {
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	entry := reflect.New(m.Type().Elem()).Elem()
+	if existing := m.MapIndex(reflect.ValueOf(key)); existing.IsValid() {
+		entry.Set(existing)
+	}
+	if err := setPath(entry, path, value); err != nil {
+		return err
+	}
+	m.SetMapIndex(reflect.ValueOf(key), entry)
+	return nil
+}
+
+// fieldByName finds the struct field with the given babl.yml name.
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue parses value according to the type of v. Lists are given comma
+// separated.
+func setValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		v.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		if value != "" {
+			for _, item := range strings.Split(value, ",") {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setValue(elem, item); err != nil {
+					return err
+				}
+				list = reflect.Append(list, elem)
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("cannot set a %s from the command line", v.Type())
+	}
+	return nil
+}
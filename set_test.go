@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetOverrides(t *testing.T) {
+	sets = setFlags{
+		"cpus=0.5",
+		"mem=0",
+		"env.FOO=bar",
+		"container.docker.network=HOST",
+		"healthChecks[0].path=/health",
+		"acceptedResourceRoles=slave_public,*",
+	}
+	defer func() { sets = nil }()
+	c := execConfigParsed("image-resize")
+	if c.Cpus != 0.5 || *c.Mem != 0 {
+		t.Errorf("config mismatch: want 0.5 cpus, 0 mem; got %v, %v", c.Cpus, *c.Mem)
+	}
+	expected := "bar"
+	actual := c.Env["FOO"]
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "HOST"
+	actual = c.Container.Docker.Network
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	if c.Container.Docker.PortMappings != nil {
+		t.Errorf("config mismatch: want no port mappings; got %v", c.Container.Docker.PortMappings)
+	}
+	expected = "/health"
+	actual = c.HealthChecks[0].Path
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+	expected = "slave_public *"
+	actual = strings.Join(c.AcceptedResourceRoles, " ")
+	if expected != actual {
+		t.Errorf("config mismatch: want %s; got %s", expected, actual)
+	}
+}
+
+func TestSetTypeChecks(t *testing.T) {
+	setupFor("string-upcase")
+	for set, expected := range map[string]string{
+		"cpus=lots":                             `"lots" is not a number`,
+		"instances=1.5":                         `"1.5" is not an integer`,
+		"container.docker.forcePullImage=maybe": `"maybe" is not a boolean`,
+		"memory=16":                             "unknown field memory",
+		"cpus.max=1":                            "float64 has no fields",
+		"healthChecks[5].path=/":                "index 5 out of range, healthChecks has 1 elements",
+	} {
+		c := conf()
+		err := applySets(&c, setFlags{set})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("error mismatch for %s: want %s; got %v", set, expected, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// problem is a setting babl-build or Marathon would reject. Location is
+// where the setting comes from, e.g. "babl.yml:12", if known.
+type problem struct {
+	Path     string
+	Message  string
+	Location string
+}
+
+func (p problem) String() string {
+	msg := p.Message
+	if p.Path != "" {
+		msg = p.Path + " " + msg
+	}
+	if p.Location != "" {
+		msg = p.Location + ": " + msg
+	}
+	return msg
+}
+
+// invalidConfig lists all problems found in a config.
+type invalidConfig []problem
+
+func (problems invalidConfig) Error() string {
+	lines := []string{}
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return "Invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+func (problems invalidConfig) Len() int      { return len(problems) }
+func (problems invalidConfig) Swap(i, j int) { problems[i], problems[j] = problems[j], problems[i] }
+func (problems invalidConfig) Less(i, j int) bool {
+	fileI, lineI := problems[i].fileAndLine()
+	fileJ, lineJ := problems[j].fileAndLine()
+	switch {
+	case fileI != fileJ:
+		return fileI < fileJ
+	case lineI != lineJ:
+		return lineI < lineJ
+	case problems[i].Path != problems[j].Path:
+		return problems[i].Path < problems[j].Path
+	}
+	return problems[i].Message < problems[j].Message
+}
+
+// fileAndLine splits the location of a problem into file and line, which is
+// 0 if not known.
+func (p problem) fileAndLine() (string, int) {
+	if i := strings.LastIndex(p.Location, ":"); i >= 0 {
+		if line, err := strconv.Atoi(p.Location[i+1:]); err == nil {
+			return p.Location[:i], line
+		}
+	}
+	return p.Location, 0
+}
+
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line ([0-9]+): (.*)$`)
+
+// strictProblems reports unknown keys, wrong types and syntax errors in a
+// file holding config settings, given as YAML.
+func strictProblems(file string, contents []byte) invalidConfig {
+	var c config
+	err := yaml.UnmarshalStrict(contents, &c)
+	if err == nil {
+		return nil
+	}
+	problems := invalidConfig{}
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+	for _, msg := range messages {
+		m := yamlErrorLine.FindStringSubmatch(msg)
+		switch {
+		case m == nil:
+			problems = append(problems, problem{Message: strings.TrimPrefix(msg, "yaml: "), Location: file})
+		case converted(file):
+			problems = append(problems, problem{Message: m[2], Location: file})
+		default:
+			problems = append(problems, problem{Message: m[2], Location: file + ":" + m[1]})
+		}
+	}
+	return problems
+}
+
+// lineOf returns the line of the setting at the given path, like
+// "container.volumes[0].mode", in a YAML file, or 0 if it is not found.
+func lineOf(contents []byte, path string) int {
+	var doc yaml3.Node
+	if yaml3.Unmarshal(contents, &doc) != nil || len(doc.Content) == 0 {
+		return 0
+	}
+	node := doc.Content[0]
+	for path != "" {
+		var segment string
+		segment, path = splitPath(path)
+		m := segmentPattern.FindStringSubmatch(segment)
+		if m == nil || node.Kind != yaml3.MappingNode {
+			return 0
+		}
+		var value *yaml3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == m[1] {
+				value = node.Content[i+1]
+			}
+		}
+		if value == nil {
+			return 0
+		}
+		node = value
+		for _, index := range strings.Split(strings.Trim(m[2], "[]"), "][") {
+			if index == "" {
+				continue
+			}
+			i, _ := strconv.Atoi(index)
+			if node.Kind != yaml3.SequenceNode || i >= len(node.Content) {
+				return 0
+			}
+			node = node.Content[i]
+		}
+	}
+	return node.Line
+}
+
+// locate tells for each problem which file and line the offending value
+// comes from, according to the origins recorded by conf().
+func locate(problems invalidConfig) {
+	for i := range problems {
+		p := &problems[i]
+		o, ok := _origins[p.Path]
+		if !ok {
+			continue
+		}
+		file, path := o.Source, p.Path
+		switch {
+		case o.Source == "default":
+			p.Location = "build-config.yml (built-in)"
+			continue
+		case o.Source == "--set":
+			p.Location = "--set"
+			continue
+		case o.Source == "rule":
+			continue
+		case strings.HasPrefix(o.Source, "profile "):
+			file, path = manifestPath(), "profiles."+strings.TrimPrefix(o.Source, "profile ")+"."+path
+		}
+		p.Location = file
+		if converted(file) {
+			continue
+		}
+		if contents, err := ioutil.ReadFile(expandHome(file)); err == nil {
+			if line := lineOf(contents, path); line > 0 {
+				p.Location += ":" + strconv.Itoa(line)
+			}
+		}
+	}
+}
+
+// validateConfig checks the manifest and defaults files for unknown keys and
+// wrong types, and the merged config for values Marathon would reject.
+func validateConfig() error {
+	problems := invalidConfig{}
+	for _, file := range append(append([]string{}, defaultsFiles...), manifestPath()) {
+		contents, err := readManifest(expandHome(file))
+		if os.IsNotExist(err) && file != manifestPath() {
+			continue
+		} else if err != nil {
+			return err
+		}
+		problems = append(problems, strictProblems(file, contents)...)
+	}
+	if len(problems) > 0 {
+		return problems // conf() cannot parse the files either
+	}
+	if err := conf().validate(); err != nil {
+		merged := err.(invalidConfig)
+		locate(merged)
+		problems = append(problems, merged...)
+	}
+	if len(problems) > 0 {
+		sort.Sort(problems)
+		return problems
+	}
+	return nil
+}
+
+// mustValidate exits with all problems found in the config, if any.
+func mustValidate() {
+	if err := validateConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
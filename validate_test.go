@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func validationProblems(module string) []string {
+	setupFor(module)
+	err := validateConfig()
+	if err == nil {
+		return nil
+	}
+	problems := []string{}
+	for _, p := range err.(invalidConfig) {
+		problems = append(problems, p.String())
+	}
+	return problems
+}
+
+func assertProblems(t *testing.T, expected, actual []string) {
+	if len(expected) != len(actual) {
+		t.Fatalf("validation mismatch: want %q; got %q", expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("validation mismatch: want %s; got %s", expected[i], actual[i])
+		}
+	}
+}
+
+func TestValidFixtures(t *testing.T) {
+	for _, module := range []string{"babl-build", "string-upcase", "health-checks", "placement"} {
+		if problems := validationProblems(module); problems != nil {
+			t.Errorf("validation mismatch for %s: want no problems; got %q", module, problems)
+		}
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	assertProblems(t, []string{
+		"babl.yml:2: field memory not found in type main.config",
+		"babl.yml:3: cannot unmarshal !!str `lots` into float64",
+	}, validationProblems("unknown-keys"))
+}
+
+func TestInvalidValues(t *testing.T) {
+	assertProblems(t, []string{
+		"babl.yml:2: cpus must be greater than 0, got -0.5",
+		`babl.yml:5: container.docker.network must be BRIDGE, HOST or USER, got "NAT"`,
+		"babl.yml:8: container.docker.portMappings[0].containerPort must be a port between 0 and 65535, got 70000",
+		`babl.yml:12: container.volumes[0].containerPath must be an absolute path, got "var/run/docker.sock"`,
+		`babl.yml:13: container.volumes[0].mode must be RO or RW, got "rw"`,
+	}, validationProblems("invalid-values"))
+}
+
+func TestInvalidProfileValues(t *testing.T) {
+	profile = "production"
+	defer func() { profile = "" }()
+	problems := validationProblems("invalid-values")
+	expected := "babl.yml:16: mem must be ≥ 0, got -1"
+	for _, actual := range problems {
+		if actual == expected {
+			return
+		}
+	}
+	t.Errorf("validation mismatch: want %s; got %q", expected, problems)
+}